@@ -4,27 +4,51 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	bq "cloud.google.com/go/bigquery"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/driver"
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/utils"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	bqapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/api/iterator"
 )
 
 type API struct {
 	Client *bq.Client
+	// Service makes the REST calls the client does not support, such as
+	// reading selected columns of a table
+	Service *bqapi.Service
+	schemas *schemaCache
 }
 
 func New(client *bq.Client) *API {
-	return &API{client}
+	return &API{Client: client, schemas: newSchemaCache(DefaultSchemaCacheTTL)}
 }
 
-func (a *API) ListDatasets(ctx context.Context) ([]string, error) {
+// SetService sets the REST service of the client project, used for the calls
+// the client does not support
+func (a *API) SetService(service *bqapi.Service) {
+	a.Service = service
+}
+
+// SetSchemaCacheTTL sets how long table names and schemas are cached
+func (a *API) SetSchemaCacheTTL(ttl time.Duration) {
+	a.schemas.ttl = ttl
+}
+
+func (a *API) ListDatasets(ctx context.Context, filter string) ([]string, error) {
 
 	result := []string{}
 
 	it := a.Client.Datasets(ctx)
+	it.Filter = filter
 	for {
 		dataset, err := it.Next()
 		if err == iterator.Done {
@@ -40,18 +64,92 @@ func (a *API) ListDatasets(ctx context.Context) ([]string, error) {
 	return result, nil
 }
 
+// maxConcurrentMetadataRequests bounds the metadata requests GetDatasetInfo
+// runs at once
+const maxConcurrentMetadataRequests = 8
+
+// GetDatasetInfo returns the location, description, labels, default table
+// expiration and creation time of datasets, in the order given
+func (a *API) GetDatasetInfo(ctx context.Context, datasets []string) ([]types.DatasetInfo, error) {
+	result := make([]types.DatasetInfo, len(datasets))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentMetadataRequests)
+	for i, dataset := range datasets {
+		g.Go(func() error {
+			meta, err := a.Client.Dataset(dataset).Metadata(ctx)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s dataset metadata", dataset))
+			}
+			result[i] = types.DatasetInfo{
+				ID:                     dataset,
+				Location:               meta.Location,
+				Description:            meta.Description,
+				Labels:                 meta.Labels,
+				DefaultTableExpiration: meta.DefaultTableExpiration,
+				CreationTime:           meta.CreationTime,
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (a *API) ListTables(ctx context.Context, dataset string) ([]string, error) {
-	datasetRef := a.Client.Dataset(dataset)
-	result := []string{}
+	result, err := a.tableNames(ctx, dataset)
+	if err != nil {
+		errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to list tables in dataset '%s'", dataset))
+		jsonResponse, err := json.Marshal(errorResponse)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to marshal error response")
+		}
+		return nil, errors.New(string(jsonResponse))
+	}
 
-	it := datasetRef.Tables(ctx)
+	return result, nil
+}
+
+// tableNames returns the names of the tables in a dataset, from the schema
+// cache when the dataset could be loaded in bulk
+func (a *API) tableNames(ctx context.Context, dataset string) ([]string, error) {
+	if cached := a.schemas.dataset(ctx, a.Client, dataset); cached.err == nil {
+		return slices.Clone(cached.names), nil
+	}
+
+	result := []string{}
+	it := a.Client.Dataset(dataset).Tables(ctx)
 	for {
 		table, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to list tables in dataset '%s'", dataset))
+			return nil, err
+		}
+
+		result = append(result, table.TableID)
+	}
+
+	return result, nil
+}
+
+// ListRoutines returns the persistent functions, table functions and stored
+// procedures of a dataset with their signatures. Listing routines only returns
+// their names, so their metadata is fetched concurrently.
+func (a *API) ListRoutines(ctx context.Context, dataset string) ([]types.Routine, error) {
+	datasetRef := a.Client.Dataset(dataset)
+	names := []string{}
+
+	it := datasetRef.Routines(ctx)
+	for {
+		routine, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to list routines in dataset '%s'", dataset))
 			jsonResponse, err := json.Marshal(errorResponse)
 			if err != nil {
 				return nil, errors.WithMessage(err, "Failed to marshal error response")
@@ -59,14 +157,74 @@ func (a *API) ListTables(ctx context.Context, dataset string) ([]string, error)
 			return nil, errors.New(string(jsonResponse))
 		}
 
-		result = append(result, table.TableID)
+		names = append(names, routine.RoutineID)
 	}
 
+	result := make([]types.Routine, len(names))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentMetadataRequests)
+	for i, name := range names {
+		g.Go(func() error {
+			meta, err := datasetRef.Routine(name).Metadata(gCtx)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s routine metadata", name))
+			}
+			result[i] = utils.RoutineFromMetadata(name, meta)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListModels returns the BigQuery ML models of a dataset with their feature
+// and label columns. Listing models only returns their names, so their
+// metadata is fetched concurrently.
+func (a *API) ListModels(ctx context.Context, dataset string) ([]types.Model, error) {
+	datasetRef := a.Client.Dataset(dataset)
+	names := []string{}
+
+	it := datasetRef.Models(ctx)
+	for {
+		model, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to list models in dataset '%s'", dataset))
+			jsonResponse, err := json.Marshal(errorResponse)
+			if err != nil {
+				return nil, errors.WithMessage(err, "Failed to marshal error response")
+			}
+			return nil, errors.New(string(jsonResponse))
+		}
+
+		names = append(names, model.ModelID)
+	}
+
+	result := make([]types.Model, len(names))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentMetadataRequests)
+	for i, name := range names {
+		g.Go(func() error {
+			meta, err := datasetRef.Model(name).Metadata(gCtx)
+			if err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s model metadata", name))
+			}
+			result[i], err = utils.ModelFromMetadata(name, meta)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
 func (a *API) ListColumns(ctx context.Context, dataset string, table string, isOrderable bool) ([]string, error) {
-	tableMeta, err := a.Client.Dataset(dataset).Table(table).Metadata(ctx)
+	tableMeta, err := a.tableMetadata(ctx, dataset, table)
 
 	if err != nil {
 		errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to retrieve %s table columns", table))
@@ -78,21 +236,118 @@ func (a *API) ListColumns(ctx context.Context, dataset string, table string, isO
 	}
 
 	result := utils.ColumnsFromTableSchema(tableMeta.Schema, isOrderable)
+	result = append(result, utils.ColumnsFromTableSchema(utils.PseudoColumns(table, tableMeta.TimePartitioning), isOrderable)...)
 	return result, nil
 
 }
 
+// tableMetadata returns the metadata of a table. Wildcard tables, such as
+// events_*, have none of their own, so the metadata of the matching table
+// with the greatest name, usually the latest shard, is returned instead.
+func (a *API) tableMetadata(ctx context.Context, dataset string, table string) (*bq.TableMetadata, error) {
+	prefix, isWildcard := strings.CutSuffix(table, "*")
+	if !isWildcard {
+		if meta, ok := a.schemas.table(ctx, a.Client, dataset, table); ok {
+			return meta, nil
+		}
+		return a.fetchTableMetadata(ctx, dataset, table)
+	}
+
+	tables, err := a.tableNames(ctx, dataset)
+	if err != nil {
+		return nil, err
+	}
+	var latest string
+	for _, t := range tables {
+		if strings.HasPrefix(t, prefix) && t > latest {
+			latest = t
+		}
+	}
+	if latest == "" {
+		return nil, fmt.Errorf("no table in dataset %s matches %s", dataset, table)
+	}
+	return a.tableMetadata(ctx, dataset, latest)
+}
+
+// fetchTableMetadata reads the full metadata of a table and caches it
+func (a *API) fetchTableMetadata(ctx context.Context, dataset string, table string) (*bq.TableMetadata, error) {
+	meta, err := a.Client.Dataset(dataset).Table(table).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.schemas.storeTableMetadata(dataset, table, meta)
+	return meta, nil
+}
+
+// ListColumnMetadata returns the columns of a table, including the fields
+// nested in RECORD columns and the pseudo-columns of the table, that match
+// filter
+func (a *API) ListColumnMetadata(ctx context.Context, dataset string, table string, filter utils.ColumnFilter) ([]types.ColumnMetadata, error) {
+	tableMeta, err := a.tableMetadata(ctx, dataset, table)
+
+	if err != nil {
+		errorResponse, _ := utils.HandleError(ctx, err, fmt.Sprintf("Failed to retrieve %s table columns", table))
+		jsonResponse, err := json.Marshal(errorResponse)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to marshal error response")
+		}
+		return nil, errors.New(string(jsonResponse))
+	}
+
+	result := utils.ColumnMetadataFromTableSchema(tableMeta.Schema, filter)
+	for _, column := range utils.ColumnMetadataFromTableSchema(utils.PseudoColumns(table, tableMeta.TimePartitioning), filter) {
+		column.Pseudo = true
+		result = append(result, column)
+	}
+	return result, nil
+}
+
 func (a *API) GetTableSchema(ctx context.Context, dataset, table string) (*types.TableMetadataResponse, error) {
-	tableMeta, err := a.Client.Dataset(dataset).Table(table).Metadata(ctx)
+	tableMeta, ok := a.schemas.tableMetadata(dataset, table)
+	var err error
+	if !ok {
+		tableMeta, err = a.fetchTableMetadata(ctx, dataset, table)
+	}
 	if err != nil {
 		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s table metadata", table))
 	}
 
+	result, err := tableMetadataResponse(tableMeta)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to parse %s table metadata", table))
+	}
+
+	// The client library does not read the physical size of the table
+	if a.Service != nil {
+		physical, err := a.Service.Tables.Get(a.Client.Project(), dataset, table).Fields("numPhysicalBytes").Context(ctx).Do()
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s table size", table))
+		}
+		result.NumPhysicalBytes = physical.NumPhysicalBytes
+	}
+
+	return result, nil
+}
+
+func tableMetadataResponse(tableMeta *bq.TableMetadata) (*types.TableMetadataResponse, error) {
 	response, _ := json.Marshal(tableMeta)
 	result := &types.TableMetadataResponse{}
 
 	if err := json.Unmarshal(response, result); err != nil {
-		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to parse %s table metadata", table))
+		return nil, err
+	}
+
+	// Fields not matching the BigQuery metadata by name
+	result.ClusteringFields = nil
+	if tableMeta.Clustering != nil {
+		result.ClusteringFields = tableMeta.Clustering.Fields
+	}
+	result.ExpirationTime = nil
+	if !tableMeta.ExpirationTime.IsZero() {
+		result.ExpirationTime = &tableMeta.ExpirationTime
+	}
+	if tableMeta.MaterializedView != nil {
+		result.ViewQuery = tableMeta.MaterializedView.Query
 	}
 
 	return result, nil
@@ -128,3 +383,197 @@ func (a *API) ValidateQuery(ctx context.Context, query string) *ValidateQueryRes
 
 	return response
 }
+
+// maxSchemaSearchResults bounds the number of results SearchSchema returns
+const maxSchemaSearchResults = 1000
+
+// schemaSearchLocationPattern matches the locations SearchSchema accepts,
+// which are interpolated into the region qualifier of the search query
+var schemaSearchLocationPattern = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// maxMetadataBytesBilled caps the bytes billed by the INFORMATION_SCHEMA
+// queries run to read the schema, which scan the metadata of every dataset
+// of a project in a location
+const maxMetadataBytesBilled = 1 << 30
+
+// TablePattern matches the tables whose dataset and name match the RE2
+// regular expressions Dataset and Table
+type TablePattern struct {
+	Dataset string `bigquery:"dataset"`
+	Table   string `bigquery:"table"`
+}
+
+// SchemaSearchRestriction limits a schema search to the tables a data source
+// may query
+type SchemaSearchRestriction struct {
+	// Allowed are the tables that may be queried, all of them when nil
+	Allowed []TablePattern
+	// Denied are the tables that may not be queried, even when allowed
+	Denied []TablePattern
+}
+
+// schemaSearchQuery returns the query SearchSchema runs: up to @limit of the
+// tables whose name contains @term, followed by the columns whose name does,
+// across every dataset of the project in a location. With a restriction, only
+// the tables matching @allowed and none of @denied are searched.
+func schemaSearchQuery(project, location string, restriction *SchemaSearchRestriction) string {
+	region := fmt.Sprintf("`%s`.`region-%s`.INFORMATION_SCHEMA", project, strings.ToLower(location))
+	var filters []string
+	if restriction != nil && restriction.Allowed != nil {
+		filters = append(filters, "EXISTS (SELECT 1 FROM UNNEST(@allowed) a WHERE REGEXP_CONTAINS(r.table_schema, a.dataset) AND REGEXP_CONTAINS(r.table_name, a.table))")
+	}
+	if restriction != nil && len(restriction.Denied) > 0 {
+		filters = append(filters, "NOT EXISTS (SELECT 1 FROM UNNEST(@denied) d WHERE REGEXP_CONTAINS(r.table_schema, d.dataset) AND REGEXP_CONTAINS(r.table_name, d.table))")
+	}
+	where := ""
+	if len(filters) > 0 {
+		where = "\nWHERE " + strings.Join(filters, "\n  AND ")
+	}
+	return fmt.Sprintf(`SELECT r.* FROM (
+SELECT table_schema, table_name, table_type, CAST(NULL AS STRING) AS column_name, CAST(NULL AS STRING) AS data_type
+FROM %[1]s.TABLES
+WHERE STRPOS(LOWER(table_name), LOWER(@term)) > 0
+UNION ALL
+SELECT c.table_schema, c.table_name, t.table_type, c.column_name, c.data_type
+FROM %[1]s.COLUMNS c
+JOIN %[1]s.TABLES t USING (table_schema, table_name)
+WHERE STRPOS(LOWER(c.column_name), LOWER(@term)) > 0
+) r%[2]s
+ORDER BY table_schema, table_name, column_name NULLS FIRST
+LIMIT @limit`, region, where)
+}
+
+// SearchSchema finds up to limit tables and columns whose name contains term,
+// case insensitively, across all datasets of the client project in a
+// location. With a restriction, only the tables it allows are searched.
+func (a *API) SearchSchema(ctx context.Context, location, term string, limit int, restriction *SchemaSearchRestriction) ([]types.SchemaSearchResult, error) {
+	if limit <= 0 || limit > maxSchemaSearchResults {
+		return nil, fmt.Errorf("the result limit must be between 1 and %d", maxSchemaSearchResults)
+	}
+	if !schemaSearchLocationPattern.MatchString(location) {
+		return nil, fmt.Errorf("invalid location %q", location)
+	}
+	result := []types.SchemaSearchResult{}
+	if restriction != nil && restriction.Allowed != nil && len(restriction.Allowed) == 0 {
+		return result, nil
+	}
+
+	q := a.Client.Query(schemaSearchQuery(a.Client.Project(), location, restriction))
+	q.Location = location
+	q.MaxBytesBilled = maxMetadataBytesBilled
+	q.Parameters = []bq.QueryParameter{{Name: "term", Value: term}, {Name: "limit", Value: limit}}
+	if restriction != nil && restriction.Allowed != nil {
+		q.Parameters = append(q.Parameters, bq.QueryParameter{Name: "allowed", Value: restriction.Allowed})
+	}
+	if restriction != nil && len(restriction.Denied) > 0 {
+		q.Parameters = append(q.Parameters, bq.QueryParameter{Name: "denied", Value: restriction.Denied})
+	}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to search the schema")
+	}
+
+	for {
+		var row struct {
+			Dataset   string        `bigquery:"table_schema"`
+			Table     string        `bigquery:"table_name"`
+			TableType string        `bigquery:"table_type"`
+			Column    bq.NullString `bigquery:"column_name"`
+			Type      bq.NullString `bigquery:"data_type"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to search the schema")
+		}
+		result = append(result, types.SchemaSearchResult{
+			Dataset:   row.Dataset,
+			Table:     row.Table,
+			TableType: row.TableType,
+			Column:    row.Column.StringVal,
+			Type:      row.Type.StringVal,
+		})
+	}
+	return result, nil
+}
+
+// maxPreviewRows bounds the number of rows PreviewTable reads
+const maxPreviewRows = 1000
+
+// PreviewTable reads up to limit rows of a table with tabledata.list, which,
+// unlike a query, is not billed. Only the given columns are read, or all of
+// them when columns is empty.
+func (a *API) PreviewTable(ctx context.Context, dataset, table string, columns []string, limit int) (*data.Frame, error) {
+	if limit <= 0 || limit > maxPreviewRows {
+		return nil, fmt.Errorf("the row limit must be between 1 and %d", maxPreviewRows)
+	}
+	if a.Service == nil {
+		return nil, errors.New("table previews are not available for this connection")
+	}
+
+	meta, err := a.tableMetadata(ctx, dataset, table)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s table metadata", table))
+	}
+	// The rows hold the selected columns in table order
+	schema := meta.Schema
+	if len(columns) > 0 {
+		schema = slices.DeleteFunc(slices.Clone(meta.Schema), func(field *bq.FieldSchema) bool { return !slices.Contains(columns, field.Name) })
+	}
+	indexes := make([]int, 0, len(schema))
+	for _, column := range columns {
+		index := slices.IndexFunc(schema, func(field *bq.FieldSchema) bool { return field.Name == column })
+		if index < 0 {
+			return nil, fmt.Errorf("table %s has no column %q", table, column)
+		}
+		indexes = append(indexes, index)
+	}
+	// Selecting every column keeps the rows matching a cached schema that
+	// lacks recently added columns
+	selected := make([]string, len(schema))
+	for i, field := range schema {
+		selected[i] = field.Name
+	}
+
+	var values [][]bq.Value
+	call := a.Service.Tabledata.List(a.Client.Project(), dataset, table).
+		SelectedFields(strings.Join(selected, ",")).
+		FormatOptionsUseInt64Timestamp(true).
+		Context(ctx)
+	for len(values) < limit {
+		res, err := call.MaxResults(int64(limit - len(values))).Do()
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Failed to read %s table rows", table))
+		}
+		for _, row := range res.Rows {
+			rowValues, err := valuesFromTableRow(schema, row)
+			if err != nil {
+				return nil, errors.WithMessage(err, fmt.Sprintf("Failed to read %s table rows", table))
+			}
+			values = append(values, rowValues)
+		}
+		if res.PageToken == "" || len(res.Rows) == 0 {
+			break
+		}
+		call.PageToken(res.PageToken)
+	}
+
+	if len(columns) > 0 {
+		ordered := make(bq.Schema, len(indexes))
+		for i, index := range indexes {
+			ordered[i] = schema[index]
+		}
+		for r, row := range values {
+			selected := make([]bq.Value, len(indexes))
+			for i, index := range indexes {
+				selected[i] = row[index]
+			}
+			values[r] = selected
+		}
+		schema = ordered
+	}
+
+	return driver.FrameFromTableRows(table, schema, values)
+}
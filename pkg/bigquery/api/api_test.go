@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/bqtest"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bqapi "google.golang.org/api/bigquery/v2"
+)
+
+func Test_tableMetadataResponse(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := modified.Add(30 * 24 * time.Hour)
+
+	t.Run("table", func(t *testing.T) {
+		result, err := tableMetadataResponse(&bq.TableMetadata{
+			Type:             bq.RegularTable,
+			Description:      "Orders",
+			Labels:           map[string]string{"team": "sales"},
+			Schema:           bq.Schema{{Name: "id", Type: bq.IntegerFieldType}},
+			TimePartitioning: &bq.TimePartitioning{Type: bq.DayPartitioningType, Field: "created_at"},
+			Clustering:       &bq.Clustering{Fields: []string{"region", "customer_id"}},
+			NumRows:          1000,
+			NumBytes:         2048,
+			ExpirationTime:   expires,
+			LastModifiedTime: modified,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, bq.RegularTable, result.Type)
+		assert.Equal(t, "Orders", result.Description)
+		assert.Equal(t, map[string]string{"team": "sales"}, result.Labels)
+		assert.Equal(t, "created_at", result.TimePartitioning.Field)
+		assert.Equal(t, []string{"region", "customer_id"}, result.ClusteringFields)
+		assert.Equal(t, uint64(1000), result.NumRows)
+		assert.Equal(t, int64(2048), result.NumBytes)
+		assert.Equal(t, expires, *result.ExpirationTime)
+		assert.Equal(t, modified, result.LastModifiedTime)
+		assert.Empty(t, result.ViewQuery)
+	})
+
+	t.Run("views", func(t *testing.T) {
+		result, err := tableMetadataResponse(&bq.TableMetadata{Type: bq.ViewTable, ViewQuery: "SELECT 1"})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT 1", result.ViewQuery)
+		assert.Nil(t, result.ExpirationTime)
+		assert.Nil(t, result.ClusteringFields)
+
+		result, err = tableMetadataResponse(&bq.TableMetadata{Type: bq.MaterializedView, MaterializedView: &bq.MaterializedViewDefinition{Query: "SELECT 2"}})
+		require.NoError(t, err)
+		assert.Equal(t, bq.MaterializedView, result.Type)
+		assert.Equal(t, "SELECT 2", result.ViewQuery)
+	})
+
+	t.Run("serialized field names", func(t *testing.T) {
+		result, err := tableMetadataResponse(&bq.TableMetadata{Type: bq.Snapshot, Clustering: &bq.Clustering{Fields: []string{"region"}}})
+		require.NoError(t, err)
+		raw, err := json.Marshal(result)
+		require.NoError(t, err)
+		assert.Contains(t, string(raw), `"type":"SNAPSHOT"`)
+		assert.Contains(t, string(raw), `"clusteringFields":["region"]`)
+		assert.NotContains(t, string(raw), "expirationTime")
+	})
+}
+
+func TestListColumns_wildcardTables(t *testing.T) {
+	list := bqapi.TableList{}
+	for _, id := range []string{"events_20240101", "events_20240103", "events_20240102", "other"} {
+		list.Tables = append(list.Tables, &bqapi.TableListTables{TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "logs", TableId: id}})
+	}
+	client := bqtest.NewClient(t, map[string]any{
+		"/datasets/logs/tables": list,
+		"/datasets/logs/tables/events_20240103": bqapi.Table{
+			TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "logs", TableId: "events_20240103"},
+			Schema:         &bqapi.TableSchema{Fields: []*bqapi.TableFieldSchema{{Name: "message", Type: "STRING"}}},
+		},
+	})
+
+	columns, err := New(client).ListColumns(t.Context(), "logs", "events_*", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"message", "_TABLE_SUFFIX"}, columns)
+
+	_, err = New(client).ListColumns(t.Context(), "logs", "missing_*", false)
+	assert.ErrorContains(t, err, "no table in dataset logs matches missing_*")
+}
+
+func TestListDatasets_details(t *testing.T) {
+	var filters []string
+	client := bqtest.NewClient(t, map[string]any{
+		"/projects/p/datasets": func(r *http.Request) any {
+			filters = append(filters, r.URL.Query().Get("filter"))
+			return bqapi.DatasetList{Datasets: []*bqapi.DatasetListDatasets{
+				{DatasetReference: &bqapi.DatasetReference{ProjectId: "p", DatasetId: "sales_eu"}},
+				{DatasetReference: &bqapi.DatasetReference{ProjectId: "p", DatasetId: "sales_us"}},
+			}}
+		},
+		"/datasets/sales_eu": bqapi.Dataset{
+			DatasetReference:         &bqapi.DatasetReference{ProjectId: "p", DatasetId: "sales_eu"},
+			Location:                 "EU",
+			Description:              "EU sales",
+			Labels:                   map[string]string{"env": "prod"},
+			DefaultTableExpirationMs: 3600000,
+			CreationTime:             1704067200000,
+		},
+		"/datasets/sales_us": bqapi.Dataset{DatasetReference: &bqapi.DatasetReference{ProjectId: "p", DatasetId: "sales_us"}, Location: "US"},
+	})
+
+	datasets, err := New(client).ListDatasets(t.Context(), "labels.env:prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sales_eu", "sales_us"}, datasets)
+	assert.Equal(t, []string{"labels.env:prod"}, filters)
+
+	details, err := New(client).GetDatasetInfo(t.Context(), datasets)
+	require.NoError(t, err)
+	require.Len(t, details, 2)
+	assert.Equal(t, "sales_eu", details[0].ID)
+	assert.Equal(t, "EU", details[0].Location)
+	assert.Equal(t, "EU sales", details[0].Description)
+	assert.Equal(t, map[string]string{"env": "prod"}, details[0].Labels)
+	assert.Equal(t, time.Hour, details[0].DefaultTableExpiration)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), details[0].CreationTime.UTC())
+	assert.Equal(t, "US", details[1].Location)
+
+	_, err = New(client).GetDatasetInfo(t.Context(), []string{"missing"})
+	assert.ErrorContains(t, err, "Failed to retrieve missing dataset metadata")
+}
+
+func TestListRoutines(t *testing.T) {
+	client := bqtest.NewClient(t, map[string]any{
+		"/datasets/udf/routines": bqapi.ListRoutinesResponse{Routines: []*bqapi.Routine{
+			{RoutineReference: &bqapi.RoutineReference{ProjectId: "p", DatasetId: "udf", RoutineId: "parse_url"}},
+			{RoutineReference: &bqapi.RoutineReference{ProjectId: "p", DatasetId: "udf", RoutineId: "refresh"}},
+		}},
+		"/datasets/udf/routines/parse_url": bqapi.Routine{
+			RoutineReference: &bqapi.RoutineReference{ProjectId: "p", DatasetId: "udf", RoutineId: "parse_url"},
+			RoutineType:      "SCALAR_FUNCTION",
+			Language:         "SQL",
+			DefinitionBody:   "NET.HOST(url)",
+			Arguments:        []*bqapi.Argument{{Name: "url", DataType: &bqapi.StandardSqlDataType{TypeKind: "STRING"}}},
+			ReturnType:       &bqapi.StandardSqlDataType{TypeKind: "STRING"},
+		},
+		"/datasets/udf/routines/refresh": bqapi.Routine{
+			RoutineReference: &bqapi.RoutineReference{ProjectId: "p", DatasetId: "udf", RoutineId: "refresh"},
+			RoutineType:      "PROCEDURE",
+			DefinitionBody:   "SELECT 1",
+		},
+	})
+
+	routines, err := New(client).ListRoutines(t.Context(), "udf")
+	require.NoError(t, err)
+	require.Len(t, routines, 2)
+	assert.Equal(t, "parse_url(url STRING) -> STRING", routines[0].Signature)
+	assert.Equal(t, "SQL", routines[0].Language)
+	assert.Equal(t, "PROCEDURE", routines[1].Type)
+
+	_, err = New(client).ListRoutines(t.Context(), "missing")
+	assert.ErrorContains(t, err, `"code":404`)
+}
+
+func TestListModels(t *testing.T) {
+	client := bqtest.NewClient(t, map[string]any{
+		"/datasets/forecasts/models": bqapi.ListModelsResponse{Models: []*bqapi.Model{
+			{ModelReference: &bqapi.ModelReference{ProjectId: "p", DatasetId: "forecasts", ModelId: "traffic"}},
+		}},
+		"/datasets/forecasts/models/traffic": bqapi.Model{
+			ModelReference: &bqapi.ModelReference{ProjectId: "p", DatasetId: "forecasts", ModelId: "traffic"},
+			ModelType:      "ARIMA_PLUS",
+			Description:    "Daily traffic forecast",
+			CreationTime:   1704067200000,
+			FeatureColumns: []*bqapi.StandardSqlField{{Name: "day", Type: &bqapi.StandardSqlDataType{TypeKind: "DATE"}}},
+			LabelColumns:   []*bqapi.StandardSqlField{{Name: "predicted_visits", Type: &bqapi.StandardSqlDataType{TypeKind: "FLOAT64"}}},
+			TrainingRuns: []*bqapi.TrainingRun{
+				{StartTime: "2024-01-02T00:00:00Z"},
+				{StartTime: "2024-02-01T06:30:00.5Z"},
+			},
+		},
+	})
+
+	models, err := New(client).ListModels(t.Context(), "forecasts")
+	require.NoError(t, err)
+	require.Len(t, models, 1)
+	assert.Equal(t, "traffic", models[0].Name)
+	assert.Equal(t, "ARIMA_PLUS", models[0].Type)
+	assert.Equal(t, "Daily traffic forecast", models[0].Description)
+	assert.Equal(t, []types.ModelColumn{{Name: "day", Type: "DATE"}}, models[0].FeatureColumns)
+	assert.Equal(t, []types.ModelColumn{{Name: "predicted_visits", Type: "FLOAT64"}}, models[0].LabelColumns)
+	require.NotNil(t, models[0].TrainingTime)
+	assert.Equal(t, time.Date(2024, 2, 1, 6, 30, 0, 500000000, time.UTC), *models[0].TrainingTime)
+	assert.Nil(t, models[0].ExpirationTime)
+
+	_, err = New(client).ListModels(t.Context(), "missing")
+	assert.ErrorContains(t, err, `"code":404`)
+}
+
+func TestPreviewTable(t *testing.T) {
+	var selected []string
+	server := bqtest.NewServer(t, map[string]any{
+		"/datasets/ds/tables/events": bqapi.Table{
+			TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "ds", TableId: "events"},
+			Schema: &bqapi.TableSchema{Fields: []*bqapi.TableFieldSchema{
+				{Name: "time", Type: "TIMESTAMP"},
+				{Name: "name", Type: "STRING"},
+				{Name: "count", Type: "INTEGER"},
+			}},
+		},
+		"/datasets/ds/tables/events/data": func(r *http.Request) any {
+			selected = append(selected, r.URL.Query().Get("selectedFields"))
+			assert.Equal(t, "true", r.URL.Query().Get("formatOptions.useInt64Timestamp"))
+			if r.URL.Query().Get("pageToken") == "" {
+				assert.Equal(t, "3", r.URL.Query().Get("maxResults"))
+				return bqapi.TableDataList{
+					PageToken: "next",
+					Rows: []*bqapi.TableRow{
+						{F: []*bqapi.TableCell{{V: "1704067200000000"}, {V: "7"}}},
+						{F: []*bqapi.TableCell{{V: "1704067260000000"}, {V: nil}}},
+					},
+				}
+			}
+			assert.Equal(t, "1", r.URL.Query().Get("maxResults"))
+			return bqapi.TableDataList{
+				PageToken: "last",
+				Rows:      []*bqapi.TableRow{{F: []*bqapi.TableCell{{V: "1704067320000000"}, {V: "9"}}}},
+			}
+		},
+	})
+	client, err := bq.NewClient(t.Context(), "p", bqtest.ClientOptions(server)...)
+	require.NoError(t, err)
+	service, err := bqapi.NewService(t.Context(), bqtest.ClientOptions(server)...)
+	require.NoError(t, err)
+	a := New(client)
+	a.SetService(service)
+
+	frame, err := a.PreviewTable(t.Context(), "ds", "events", []string{"count", "time"}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"time,count", "time,count"}, selected)
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, "count", frame.Fields[0].Name)
+	assert.Equal(t, "time", frame.Fields[1].Name)
+	require.Equal(t, 3, frame.Rows())
+	count, _ := frame.Fields[0].ConcreteAt(0)
+	assert.Equal(t, int64(7), count)
+	_, ok := frame.Fields[0].ConcreteAt(1)
+	assert.False(t, ok)
+	first, _ := frame.Fields[1].ConcreteAt(0)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), first)
+
+	_, err = a.PreviewTable(t.Context(), "ds", "events", []string{"missing"}, 3)
+	assert.ErrorContains(t, err, `table events has no column "missing"`)
+}
+
+func TestGetTableSchema_physicalSize(t *testing.T) {
+	server := bqtest.NewServer(t, map[string]any{
+		"/datasets/ds/tables/events": func(r *http.Request) any {
+			if r.URL.Query().Get("fields") == "numPhysicalBytes" {
+				return bqapi.Table{NumPhysicalBytes: 512}
+			}
+			return bqapi.Table{
+				TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "ds", TableId: "events"},
+				Schema:         &bqapi.TableSchema{Fields: []*bqapi.TableFieldSchema{{Name: "id", Type: "INTEGER"}}},
+				NumBytes:       2048,
+			}
+		},
+	})
+	client, err := bq.NewClient(t.Context(), "p", bqtest.ClientOptions(server)...)
+	require.NoError(t, err)
+	service, err := bqapi.NewService(t.Context(), bqtest.ClientOptions(server)...)
+	require.NoError(t, err)
+	a := New(client)
+	a.SetService(service)
+
+	result, err := a.GetTableSchema(t.Context(), "ds", "events")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), result.NumBytes)
+	assert.Equal(t, int64(512), result.NumPhysicalBytes)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/utils"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultSchemaCacheTTL is how long table names and schemas are cached when
+// the data source does not configure it. It is short, as the cache cannot
+// tell when the tables of a dataset change.
+const DefaultSchemaCacheTTL = time.Minute
+
+// maxDatasetSchemaRows bounds the rows of the bulk schema query, one per
+// column or described field. Larger datasets are read from the metadata API.
+const maxDatasetSchemaRows = 100000
+
+// schemaCache holds the table names and schemas of datasets, so opening the
+// query editor on a dataset costs a single query instead of a metadata
+// request per table. Each dataset is loaded in bulk from INFORMATION_SCHEMA;
+// full table metadata fetched for the table schema route is cached alongside
+// and replaces the bulk-loaded schema of its table, as it is more recent.
+// Datasets cannot be revalidated before the TTL expires: their ETag and
+// last-modified time only change with the metadata of the dataset itself, not
+// with its tables, and the last-modified times of the tables can only be read
+// with a billed query or a metadata request per table, which cost as much as
+// loading the dataset again.
+type schemaCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	loads singleflight.Group
+
+	mu       sync.Mutex
+	datasets map[string]*datasetSchema
+	tables   map[string]*tableMetadataEntry
+}
+
+// datasetSchema is the bulk-loaded schema of a dataset. When loading failed,
+// for example because the credentials may read metadata but not run queries or
+// the dataset is too large to load in bulk, err is set and the dataset is served from the metadata API until the entry
+// expires. Once cached, an entry is never modified, so it can be read without
+// holding the lock: updates replace it with a modified copy.
+type datasetSchema struct {
+	loadedAt time.Time
+	err      error
+	names    []string
+	tables   map[string]*bq.TableMetadata
+}
+
+type tableMetadataEntry struct {
+	fetchedAt time.Time
+	meta      *bq.TableMetadata
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{
+		ttl:      ttl,
+		now:      time.Now,
+		datasets: map[string]*datasetSchema{},
+		tables:   map[string]*tableMetadataEntry{},
+	}
+}
+
+func (c *schemaCache) fresh(t time.Time) bool {
+	return c.now().Sub(t) < c.ttl
+}
+
+// dataset returns the cached schema of a dataset, loading it when missing or
+// expired. Concurrent requests for the same dataset share one load.
+func (c *schemaCache) dataset(ctx context.Context, client *bq.Client, dataset string) *datasetSchema {
+	c.mu.Lock()
+	entry, ok := c.datasets[dataset]
+	c.mu.Unlock()
+	if ok && c.fresh(entry.loadedAt) {
+		return entry
+	}
+
+	res, _, _ := c.loads.Do(dataset, func() (any, error) {
+		entry := &datasetSchema{loadedAt: c.now()}
+		entry.names, entry.tables, entry.err = loadDatasetSchema(ctx, client, dataset)
+		if entry.err != nil && ctx.Err() != nil {
+			// A cancelled request says nothing about the dataset
+			return entry, nil
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// Table metadata fetched while the dataset was loading is more recent
+		for table, cached := range c.tables {
+			if name, ok := strings.CutPrefix(table, dataset+"."); ok && entry.tables != nil && !cached.fetchedAt.Before(entry.loadedAt) {
+				entry.tables[name] = cached.meta
+			}
+		}
+		c.datasets[dataset] = entry
+		return entry, nil
+	})
+	return res.(*datasetSchema)
+}
+
+// table returns the cached metadata of a table: the full metadata when it was
+// fetched within the TTL, the bulk-loaded schema otherwise
+func (c *schemaCache) table(ctx context.Context, client *bq.Client, dataset, table string) (*bq.TableMetadata, bool) {
+	if meta, ok := c.tableMetadata(dataset, table); ok {
+		return meta, true
+	}
+	entry := c.dataset(ctx, client, dataset)
+	if entry.err != nil {
+		return nil, false
+	}
+	meta, ok := entry.tables[table]
+	return meta, ok
+}
+
+// tableMetadata returns the full metadata of a table fetched within the TTL
+func (c *schemaCache) tableMetadata(dataset, table string) (*bq.TableMetadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.tables[dataset+"."+table]
+	if !ok || !c.fresh(entry.fetchedAt) {
+		return nil, false
+	}
+	return entry.meta, true
+}
+
+// storeTableMetadata caches the full metadata of a table. It also replaces
+// the bulk-loaded schema of the table, as it is more recent, so schema changes
+// seen by the table schema route show up before the dataset expires.
+func (c *schemaCache) storeTableMetadata(dataset, table string, meta *bq.TableMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[dataset+"."+table] = &tableMetadataEntry{fetchedAt: c.now(), meta: meta}
+	if entry, ok := c.datasets[dataset]; ok && entry.err == nil {
+		updated := &datasetSchema{loadedAt: entry.loadedAt, names: entry.names, tables: maps.Clone(entry.tables)}
+		if _, ok := entry.tables[table]; !ok {
+			updated.names = append(slices.Clone(entry.names), table)
+			slices.Sort(updated.names)
+		}
+		updated.tables[table] = meta
+		c.datasets[dataset] = updated
+	}
+}
+
+// schemaIdentifierPattern matches the project and dataset names
+// loadDatasetSchema interpolates into its query
+var schemaIdentifierPattern = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// datasetSchemaQuery returns the query loading the tables of a dataset with
+// their columns, one row per column field path carrying a description or
+// policy tags, or per column otherwise, up to @limit rows
+func datasetSchemaQuery(project, dataset string) string {
+	schema := fmt.Sprintf("`%s`.`%s`.INFORMATION_SCHEMA", project, dataset)
+	return fmt.Sprintf(`SELECT t.table_name, t.table_type, c.column_name, c.is_nullable, c.is_hidden, c.data_type, f.field_path, f.description, f.policy_tags
+FROM %[1]s.TABLES t
+LEFT JOIN %[1]s.COLUMNS c ON c.table_name = t.table_name
+LEFT JOIN %[1]s.COLUMN_FIELD_PATHS f ON f.table_name = c.table_name AND f.column_name = c.column_name
+  AND (f.description IS NOT NULL OR ARRAY_LENGTH(f.policy_tags) > 0)
+ORDER BY t.table_name, c.ordinal_position
+LIMIT @limit`, schema)
+}
+
+// schemaRow is a row of datasetSchemaQuery
+type schemaRow struct {
+	Table       string        `bigquery:"table_name"`
+	TableType   string        `bigquery:"table_type"`
+	Column      bq.NullString `bigquery:"column_name"`
+	IsNullable  bq.NullString `bigquery:"is_nullable"`
+	IsHidden    bq.NullString `bigquery:"is_hidden"`
+	DataType    bq.NullString `bigquery:"data_type"`
+	FieldPath   bq.NullString `bigquery:"field_path"`
+	Description bq.NullString `bigquery:"description"`
+	PolicyTags  []string      `bigquery:"policy_tags"`
+}
+
+// informationSchemaTableTypes maps the INFORMATION_SCHEMA table types to the
+// ones the metadata API reports
+var informationSchemaTableTypes = map[string]bq.TableType{
+	"BASE TABLE":        bq.RegularTable,
+	"CLONE":             bq.RegularTable,
+	"VIEW":              bq.ViewTable,
+	"MATERIALIZED VIEW": bq.MaterializedView,
+	"EXTERNAL":          bq.ExternalTable,
+	"SNAPSHOT":          bq.Snapshot,
+}
+
+// loadDatasetSchema reads the names and schemas of all tables of a dataset
+// from INFORMATION_SCHEMA. The metadata only holds the type, schema and, for
+// tables partitioned by ingestion time, the partitioning of the tables. It
+// fails when the query would bill more than maxMetadataBytesBilled or return
+// more than maxDatasetSchemaRows rows.
+func loadDatasetSchema(ctx context.Context, client *bq.Client, dataset string) ([]string, map[string]*bq.TableMetadata, error) {
+	project := client.Project()
+	if !schemaIdentifierPattern.MatchString(project) || !schemaIdentifierPattern.MatchString(dataset) {
+		return nil, nil, fmt.Errorf("cannot query the schema of dataset %s.%s", project, dataset)
+	}
+
+	q := client.Query(datasetSchemaQuery(project, dataset))
+	q.MaxBytesBilled = maxMetadataBytesBilled
+	q.Parameters = []bq.QueryParameter{{Name: "limit", Value: maxDatasetSchemaRows + 1}}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{}
+	tables := map[string]*bq.TableMetadata{}
+	fields := map[string]*bq.FieldSchema{}
+	for rows := 0; ; rows++ {
+		var row schemaRow
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if rows == maxDatasetSchemaRows {
+			return nil, nil, fmt.Errorf("dataset %s.%s has too many columns to load in bulk", project, dataset)
+		}
+
+		meta, ok := tables[row.Table]
+		if !ok {
+			meta = &bq.TableMetadata{Name: row.Table, Type: informationSchemaTableTypes[row.TableType], Schema: bq.Schema{}}
+			tables[row.Table] = meta
+			names = append(names, row.Table)
+		}
+		if !row.Column.Valid {
+			continue
+		}
+
+		key := row.Table + "." + row.Column.StringVal
+		field, ok := fields[key]
+		if !ok {
+			field = utils.FieldSchemaFromSQLType(row.Column.StringVal, row.DataType.StringVal)
+			field.Required = row.IsNullable.StringVal == "NO" && !field.Repeated
+			fields[key] = field
+			if row.IsHidden.StringVal == "YES" {
+				addIngestionTimePartitioning(meta, field.Name)
+			} else {
+				meta.Schema = append(meta.Schema, field)
+			}
+		}
+		if row.FieldPath.Valid {
+			if nested := utils.FieldByPath(bq.Schema{field}, row.FieldPath.StringVal); nested != nil {
+				nested.Description = row.Description.StringVal
+				if len(row.PolicyTags) > 0 {
+					nested.PolicyTags = &bq.PolicyTagList{Names: row.PolicyTags}
+				}
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, tables, nil
+}
+
+// addIngestionTimePartitioning records the partitioning of a table partitioned
+// by ingestion time from its hidden pseudo-columns, as INFORMATION_SCHEMA
+// lists them as columns. Only daily partitioning, which adds _PARTITIONDATE,
+// can be told apart; other granularities are recorded as hourly.
+func addIngestionTimePartitioning(meta *bq.TableMetadata, column string) {
+	switch column {
+	case "_PARTITIONTIME":
+		if meta.TimePartitioning == nil {
+			meta.TimePartitioning = &bq.TimePartitioning{Type: bq.HourPartitioningType}
+		}
+	case "_PARTITIONDATE":
+		meta.TimePartitioning = &bq.TimePartitioning{Type: bq.DayPartitioningType}
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/bqtest"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bqapi "google.golang.org/api/bigquery/v2"
+)
+
+// schemaCacheServer routes the bulk schema query of the sales dataset and the
+// metadata of its orders table, counting the requests of each kind. Queries
+// fail with queryError when it is set.
+type schemaCacheServer struct {
+	queries, tableLists, metadata atomic.Int32
+	query                         atomic.Pointer[bqapi.QueryRequest]
+	queryError                    string
+}
+
+func (s *schemaCacheServer) routes() map[string]any {
+	tags := func(names ...string) []any {
+		res := []any{}
+		for _, name := range names {
+			res = append(res, map[string]any{"v": name})
+		}
+		return res
+	}
+	schema := bqtest.QueryResponse("p", []*bqapi.TableFieldSchema{
+		{Name: "table_name", Type: "STRING"},
+		{Name: "table_type", Type: "STRING"},
+		{Name: "column_name", Type: "STRING"},
+		{Name: "is_nullable", Type: "STRING"},
+		{Name: "is_hidden", Type: "STRING"},
+		{Name: "data_type", Type: "STRING"},
+		{Name: "field_path", Type: "STRING"},
+		{Name: "description", Type: "STRING"},
+		{Name: "policy_tags", Type: "STRING", Mode: "REPEATED"},
+	},
+		[]any{"events", "BASE TABLE", "_PARTITIONTIME", "YES", "YES", "TIMESTAMP", nil, nil, tags()},
+		[]any{"events", "BASE TABLE", "_PARTITIONDATE", "YES", "YES", "DATE", nil, nil, tags()},
+		[]any{"events", "BASE TABLE", "payload", "YES", "NO", "JSON", nil, nil, tags()},
+		[]any{"orders", "BASE TABLE", "id", "NO", "NO", "INT64", "id", "Order ID", tags()},
+		[]any{"orders", "BASE TABLE", "customer", "YES", "NO", "STRUCT<email STRING, tags ARRAY<STRING>>", "customer.email", "Contact email", tags("projects/p/locations/us/taxonomies/1/policyTags/2")},
+		[]any{"orders", "BASE TABLE", "amount", "YES", "NO", "NUMERIC(10, 2)", nil, nil, tags()},
+		[]any{"orders_view", "VIEW", "id", "YES", "NO", "INT64", nil, nil, tags()},
+	)
+
+	return map[string]any{
+		"/projects/p/queries": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.queries.Add(1)
+			request := &bqapi.QueryRequest{}
+			if err := json.NewDecoder(r.Body).Decode(request); err == nil {
+				s.query.Store(request)
+			}
+			if s.queryError != "" {
+				http.Error(w, s.queryError, http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(schema)
+		}),
+		"/datasets/sales/tables": func(*http.Request) any {
+			s.tableLists.Add(1)
+			return bqapi.TableList{Tables: []*bqapi.TableListTables{
+				{TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "sales", TableId: "orders"}},
+			}}
+		},
+		"/datasets/sales/tables/orders": func(*http.Request) any {
+			s.metadata.Add(1)
+			return bqapi.Table{
+				TableReference: &bqapi.TableReference{ProjectId: "p", DatasetId: "sales", TableId: "orders"},
+				Type:           "TABLE",
+				NumRows:        42,
+				Schema: &bqapi.TableSchema{Fields: []*bqapi.TableFieldSchema{
+					{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+					{Name: "status", Type: "STRING"},
+				}},
+			}
+		},
+	}
+}
+
+func newSchemaCacheAPI(t *testing.T, s *schemaCacheServer) *API {
+	return New(bqtest.NewClient(t, s.routes()))
+}
+
+func TestSchemaCache(t *testing.T) {
+	t.Run("serves tables and columns from one bulk query", func(t *testing.T) {
+		s := &schemaCacheServer{}
+		a := newSchemaCacheAPI(t, s)
+
+		tables, err := a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"events", "orders", "orders_view"}, tables)
+
+		columns, err := a.ListColumns(t.Context(), "sales", "orders", false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "customer", "customer.email", "customer.tags", "amount"}, columns)
+
+		metadata, err := a.ListColumnMetadata(t.Context(), "sales", "orders", utils.ColumnFilter{})
+		require.NoError(t, err)
+		assert.True(t, metadata[0].Required)
+		assert.Equal(t, "Order ID", metadata[0].Description)
+		assert.Equal(t, bq.RecordFieldType, metadata[1].Type)
+		assert.Equal(t, "Contact email", metadata[2].Description)
+		assert.Equal(t, []string{"projects/p/locations/us/taxonomies/1/policyTags/2"}, metadata[2].PolicyTags)
+		assert.True(t, metadata[3].Repeated)
+		assert.Equal(t, bq.NumericFieldType, metadata[4].Type)
+
+		columns, err = a.ListColumns(t.Context(), "sales", "events", false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payload", "_PARTITIONTIME", "_PARTITIONDATE"}, columns)
+
+		assert.Equal(t, int32(1), s.queries.Load())
+		assert.Zero(t, s.tableLists.Load())
+		assert.Zero(t, s.metadata.Load())
+
+		// The query is capped in bytes billed and rows
+		request := s.query.Load()
+		require.NotNil(t, request)
+		assert.Equal(t, int64(maxMetadataBytesBilled), request.MaximumBytesBilled)
+		require.Len(t, request.QueryParameters, 1)
+		assert.Equal(t, "limit", request.QueryParameters[0].Name)
+		assert.Equal(t, fmt.Sprint(maxDatasetSchemaRows+1), request.QueryParameters[0].ParameterValue.Value)
+	})
+
+	t.Run("caches full table metadata, which replaces the bulk-loaded schema", func(t *testing.T) {
+		s := &schemaCacheServer{}
+		a := newSchemaCacheAPI(t, s)
+
+		_, err := a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		for range 2 {
+			schema, err := a.GetTableSchema(t.Context(), "sales", "orders")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(42), schema.NumRows)
+		}
+		assert.Equal(t, int32(1), s.metadata.Load())
+
+		columns, err := a.ListColumns(t.Context(), "sales", "orders", false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "status"}, columns)
+		assert.Equal(t, int32(1), s.queries.Load())
+	})
+
+	t.Run("reloads expired datasets", func(t *testing.T) {
+		s := &schemaCacheServer{}
+		a := newSchemaCacheAPI(t, s)
+		now := time.Now()
+		a.schemas.now = func() time.Time { return now }
+
+		_, err := a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		now = now.Add(DefaultSchemaCacheTTL - time.Second)
+		_, err = a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), s.queries.Load())
+
+		now = now.Add(time.Second)
+		_, err = a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), s.queries.Load())
+	})
+
+	t.Run("falls back to the metadata API when the bulk query fails", func(t *testing.T) {
+		for _, queryError := range []string{
+			`{"error":{"code":403,"message":"Access Denied"}}`,
+			`{"error":{"code":400,"message":"Query exceeded limit for bytes billed","errors":[{"reason":"bytesBilledLimitExceeded"}]}}`,
+		} {
+			s := &schemaCacheServer{queryError: queryError}
+			a := newSchemaCacheAPI(t, s)
+
+			for range 2 {
+				tables, err := a.ListTables(t.Context(), "sales")
+				require.NoError(t, err)
+				assert.Equal(t, []string{"orders"}, tables)
+			}
+			columns, err := a.ListColumns(t.Context(), "sales", "orders", false)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"id", "status"}, columns)
+
+			assert.Equal(t, int32(1), s.queries.Load())
+			assert.Equal(t, int32(2), s.tableLists.Load())
+			assert.Equal(t, int32(1), s.metadata.Load())
+		}
+	})
+
+	t.Run("serves cached datasets while table metadata is stored", func(t *testing.T) {
+		s := &schemaCacheServer{}
+		a := newSchemaCacheAPI(t, s)
+		_, err := a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Go(func() {
+				a.schemas.storeTableMetadata("sales", fmt.Sprintf("new_%d", i), &bq.TableMetadata{Schema: bq.Schema{{Name: "id", Type: bq.IntegerFieldType}}})
+			})
+			wg.Go(func() {
+				_, err := a.ListTables(t.Context(), "sales")
+				assert.NoError(t, err)
+				_, err = a.ListColumns(t.Context(), "sales", "orders", false)
+				assert.NoError(t, err)
+			})
+		}
+		wg.Wait()
+
+		tables, err := a.ListTables(t.Context(), "sales")
+		require.NoError(t, err)
+		assert.Len(t, tables, 23)
+		assert.Equal(t, int32(1), s.queries.Load())
+	})
+}
+
+func Test_datasetSchemaQuery(t *testing.T) {
+	query := datasetSchemaQuery("example.com:p", "sales")
+	assert.Contains(t, query, "FROM `example.com:p`.`sales`.INFORMATION_SCHEMA.TABLES t")
+	assert.Contains(t, query, "`example.com:p`.`sales`.INFORMATION_SCHEMA.COLUMN_FIELD_PATHS f")
+	assert.Contains(t, query, "LIMIT @limit")
+}
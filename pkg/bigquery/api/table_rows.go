@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	bq "cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	bqapi "google.golang.org/api/bigquery/v2"
+)
+
+// valuesFromTableRow converts a row returned by the tabledata.list REST call
+// to the values the client library reads, as the library does not export its
+// conversion. Timestamps must be requested as integer microseconds.
+func valuesFromTableRow(schema bq.Schema, row *bqapi.TableRow) ([]bq.Value, error) {
+	if len(row.F) != len(schema) {
+		return nil, fmt.Errorf("row has %d values for %d columns", len(row.F), len(schema))
+	}
+	values := make([]bq.Value, len(schema))
+	for i, cell := range row.F {
+		value, err := valueFromCell(cell.V, schema[i], schema[i].Repeated)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", schema[i].Name, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// valueFromCell converts the value of a cell, which is a string, a list of
+// {"v": value} objects for repeated fields or an {"f": [...]} object for
+// records
+func valueFromCell(cell any, field *bq.FieldSchema, repeated bool) (bq.Value, error) {
+	switch cell := cell.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		if !repeated {
+			return nil, fmt.Errorf("unexpected repeated value")
+		}
+		values := make([]bq.Value, len(cell))
+		for i, element := range cell {
+			wrapped, ok := element.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected repeated value %v", element)
+			}
+			value, err := valueFromCell(wrapped["v"], field, false)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case map[string]any:
+		fields, ok := cell["f"].([]any)
+		if !ok || len(fields) != len(field.Schema) {
+			return nil, fmt.Errorf("record does not match its %d fields", len(field.Schema))
+		}
+		values := make([]bq.Value, len(fields))
+		for i, element := range fields {
+			wrapped, ok := element.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected record value %v", element)
+			}
+			value, err := valueFromCell(wrapped["v"], field.Schema[i], field.Schema[i].Repeated)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case string:
+		if field.Type == bq.RangeFieldType {
+			if field.RangeElementType == nil {
+				return nil, fmt.Errorf("RANGE column without an element type")
+			}
+			return rangeValue(cell, field.RangeElementType.Type)
+		}
+		return basicValue(cell, field.Type)
+	default:
+		return nil, fmt.Errorf("unexpected %s value %v", field.Type, cell)
+	}
+}
+
+// basicValue converts the string form of a scalar value
+func basicValue(value string, typ bq.FieldType) (bq.Value, error) {
+	switch typ {
+	case bq.StringFieldType, bq.GeographyFieldType, bq.JSONFieldType:
+		return value, nil
+	case bq.BytesFieldType:
+		return base64.StdEncoding.DecodeString(value)
+	case bq.IntegerFieldType:
+		return strconv.ParseInt(value, 10, 64)
+	case bq.FloatFieldType:
+		return strconv.ParseFloat(value, 64)
+	case bq.BooleanFieldType:
+		return strconv.ParseBool(value)
+	case bq.TimestampFieldType:
+		micros, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return time.UnixMicro(micros).UTC(), nil
+	case bq.DateFieldType:
+		return civil.ParseDate(value)
+	case bq.TimeFieldType:
+		return civil.ParseTime(value)
+	case bq.DateTimeFieldType:
+		return civil.ParseDateTime(value)
+	case bq.NumericFieldType, bq.BigNumericFieldType:
+		r, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %q", typ, value)
+		}
+		return r, nil
+	case bq.IntervalFieldType:
+		return bq.ParseInterval(value)
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", typ)
+	}
+}
+
+// rangeValue converts a RANGE value of the form [start, end), where an
+// unbounded end is UNBOUNDED
+func rangeValue(value string, element bq.FieldType) (bq.Value, error) {
+	bounds, ok := strings.CutPrefix(value, "[")
+	if ok {
+		bounds, ok = strings.CutSuffix(bounds, ")")
+	}
+	start, end, found := strings.Cut(bounds, ", ")
+	if !ok || !found {
+		return nil, fmt.Errorf("invalid RANGE value %q", value)
+	}
+
+	result := &bq.RangeValue{}
+	var err error
+	if start != "UNBOUNDED" {
+		if result.Start, err = basicValue(start, element); err != nil {
+			return nil, err
+		}
+	}
+	if end != "UNBOUNDED" {
+		if result.End, err = basicValue(end, element); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"math/big"
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bqapi "google.golang.org/api/bigquery/v2"
+)
+
+func Test_valuesFromTableRow(t *testing.T) {
+	schema := bq.Schema{
+		{Name: "tags", Type: bq.StringFieldType, Repeated: true},
+		{Name: "point", Type: bq.RecordFieldType, Schema: bq.Schema{
+			{Name: "x", Type: bq.FloatFieldType},
+			{Name: "day", Type: bq.DateFieldType},
+		}},
+		{Name: "price", Type: bq.NumericFieldType},
+		{Name: "payload", Type: bq.BytesFieldType},
+		{Name: "window", Type: bq.RangeFieldType, RangeElementType: &bq.RangeElementType{Type: bq.DateFieldType}},
+	}
+	row := &bqapi.TableRow{F: []*bqapi.TableCell{
+		{V: []any{map[string]any{"v": "a"}, map[string]any{"v": "b"}}},
+		{V: map[string]any{"f": []any{map[string]any{"v": "1.5"}, map[string]any{"v": "2024-01-02"}}}},
+		{V: "12.25"},
+		{V: "aGk="},
+		{V: "[2024-01-01, UNBOUNDED)"},
+	}}
+
+	values, err := valuesFromTableRow(schema, row)
+	require.NoError(t, err)
+	assert.Equal(t, []bq.Value{"a", "b"}, values[0])
+	assert.Equal(t, []bq.Value{1.5, civil.Date{Year: 2024, Month: 1, Day: 2}}, values[1])
+	assert.Equal(t, big.NewRat(49, 4), values[2])
+	assert.Equal(t, []byte("hi"), values[3])
+	assert.Equal(t, &bq.RangeValue{Start: civil.Date{Year: 2024, Month: 1, Day: 1}}, values[4])
+
+	_, err = valuesFromTableRow(schema[:1], row)
+	assert.ErrorContains(t, err, "row has 5 values for 1 columns")
+
+	_, err = valuesFromTableRow(bq.Schema{{Name: "n", Type: bq.IntegerFieldType}}, &bqapi.TableRow{F: []*bqapi.TableCell{{V: "x"}}})
+	assert.ErrorContains(t, err, "column n:")
+}
@@ -0,0 +1,81 @@
+// Package bqtest serves canned BigQuery API responses to the clients of
+// tests.
+package bqtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/require"
+	bqapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// NewServer starts a server answering each request with the route whose key
+// is the longest suffix of the request path. A route is either the response,
+// encoded as JSON, a func(*http.Request) any returning it, or an
+// http.HandlerFunc writing it. Requests matching no route are not found.
+func NewServer(t testing.TB, routes map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route any
+		match := ""
+		for suffix, candidate := range routes {
+			if strings.HasSuffix(r.URL.Path, suffix) && len(suffix) > len(match) {
+				route, match = candidate, suffix
+			}
+		}
+
+		response := route
+		switch route := route.(type) {
+		case nil:
+			http.NotFound(w, r)
+			return
+		case http.HandlerFunc:
+			route(w, r)
+			return
+		case func(*http.Request) any:
+			response = route(r)
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("encoding the response to %s: %s", r.URL.Path, err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// ClientOptions returns the options of a client talking to the server
+func ClientOptions(server *httptest.Server) []option.ClientOption {
+	return []option.ClientOption{option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client())}
+}
+
+// NewClient returns a client of project p talking to a server of the routes
+func NewClient(t testing.TB, routes map[string]any) *bq.Client {
+	client, err := bq.NewClient(t.Context(), "p", ClientOptions(NewServer(t, routes))...)
+	require.NoError(t, err)
+	return client
+}
+
+// QueryResponse returns the response of a completed jobs.query request with
+// the given rows, each holding one value per field
+func QueryResponse(project string, fields []*bqapi.TableFieldSchema, rows ...[]any) bqapi.QueryResponse {
+	response := bqapi.QueryResponse{
+		JobComplete:  true,
+		JobReference: &bqapi.JobReference{ProjectId: project, JobId: "job"},
+		Schema:       &bqapi.TableSchema{Fields: fields},
+		Rows:         []*bqapi.TableRow{},
+		TotalRows:    uint64(len(rows)),
+	}
+	for _, values := range rows {
+		row := &bqapi.TableRow{}
+		for _, v := range values {
+			row.F = append(row.F, &bqapi.TableCell{V: v})
+		}
+		response.Rows = append(response.Rows, row)
+	}
+	return response
+}
@@ -0,0 +1,30 @@
+package bigquery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
+)
+
+// jsonConverter puts JSON columns into JSON frame fields, so Grafana renders
+// them with the JSON cell renderer and the "Extract fields" transformation
+// can parse them without a string conversion.
+var jsonConverter = sqlutil.Converter{
+	Name:          "BigQuery JSON converter",
+	InputScanType: reflect.TypeOf(sql.NullString{}),
+	InputTypeName: "JSON",
+	FrameConverter: sqlutil.FrameConverter{
+		FieldType: data.FieldTypeNullableJSON,
+		ConverterFunc: func(in interface{}) (interface{}, error) {
+			v := in.(*sql.NullString)
+			if !v.Valid {
+				return (*json.RawMessage)(nil), nil
+			}
+			raw := json.RawMessage(v.String)
+			return &raw, nil
+		},
+	},
+}
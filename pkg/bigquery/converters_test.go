@@ -0,0 +1,25 @@
+package bigquery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_jsonConverter(t *testing.T) {
+	t.Run("valid value becomes a raw JSON message", func(t *testing.T) {
+		v, err := jsonConverter.FrameConverter.ConverterFunc(&sql.NullString{String: `{"a":1}`, Valid: true})
+		require.NoError(t, err)
+		expected := json.RawMessage(`{"a":1}`)
+		assert.Equal(t, &expected, v)
+	})
+
+	t.Run("null value becomes a nil raw JSON message", func(t *testing.T) {
+		v, err := jsonConverter.FrameConverter.ConverterFunc(&sql.NullString{})
+		require.NoError(t, err)
+		assert.Equal(t, (*json.RawMessage)(nil), v)
+	})
+}
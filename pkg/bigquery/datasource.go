@@ -1,6 +1,7 @@
 package bigquery
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -20,6 +21,8 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 	"github.com/grafana/sqlds/v5"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	bqapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/api/cloudresourcemanager/v3"
 	"google.golang.org/api/option"
 
@@ -37,9 +40,16 @@ var (
 type BigqueryDatasourceIface interface {
 	sqlds.Driver
 	Datasets(ctx context.Context, args DatasetsArgs) ([]string, error)
+	DatasetDetails(ctx context.Context, args DatasetsArgs) ([]types.DatasetInfo, error)
 	TableSchema(ctx context.Context, args TableSchemaArgs) (*types.TableMetadataResponse, error)
 	ValidateQuery(ctx context.Context, args ValidateQueryArgs) (*api.ValidateQueryResponse, error)
 	Projects(ctx context.Context, options ProjectsArgs) ([]*Project, error)
+	RefreshAccessibleProjects(ctx context.Context) ([]string, error)
+	TablePreview(ctx context.Context, args TablePreviewArgs) (*data.Frame, error)
+	TableColumns(ctx context.Context, args TableColumnsArgs) ([]types.ColumnMetadata, error)
+	Routines(ctx context.Context, args RoutinesArgs) ([]types.Routine, error)
+	Models(ctx context.Context, args ModelsArgs) ([]types.Model, error)
+	SearchSchema(ctx context.Context, args SchemaSearchArgs) ([]types.SchemaSearchResult, error)
 }
 
 type conn struct {
@@ -53,6 +63,11 @@ type BigQueryDatasource struct {
 	connections               sync.Map
 	apiClients                sync.Map
 	accessibleProjectsCache   sync.Map
+	accessibleProjectsErrors  sync.Map
+	accessibleProjectsFetches singleflight.Group
+	datasetLocations          sync.Map
+	allowlistVerdictsMu       sync.Mutex
+	allowlistVerdicts         map[string]allowlistVerdictEntry
 	bqFactory                 bqServiceFactory
 	resourceManagerServicesMu sync.RWMutex
 	resourceManagerServices   map[string]*cloudresourcemanager.Service
@@ -62,11 +77,57 @@ type BigQueryDatasource struct {
 type accessibleProjectsEntry struct {
 	projects  []string
 	fetchedAt time.Time
+	// settingsUpdated identifies the data source settings, and so the project
+	// scope, the projects were listed with
+	settingsUpdated time.Time
 }
 
+// accessibleProjectsFailure records the last failure to list the accessible
+// projects of a data source
+type accessibleProjectsFailure struct {
+	err             error
+	failedAt        time.Time
+	settingsUpdated time.Time
+}
+
+// accessibleProjectsCacheTTL is how long the accessible projects are cached
+// when the data source does not configure it
 const accessibleProjectsCacheTTL = 5 * time.Minute
 
+// accessibleProjectsMaxStaleness bounds how long past their TTL the last
+// listed accessible projects keep being served while the resource manager
+// cannot be reached
+const accessibleProjectsMaxStaleness = time.Hour
+
+// accessibleProjectsRetryBackoff is how long after failing to list the
+// accessible projects of a data source queries do not list them again
+const accessibleProjectsRetryBackoff = 30 * time.Second
+
+// accessibleProjectsFetchTimeout bounds listing the accessible projects in
+// the background
+const accessibleProjectsFetchTimeout = time.Minute
+
+// accessibleProjectsTTL returns how long the accessible projects of a data
+// source are cached
+func accessibleProjectsTTL(settings types.BigQuerySettings) time.Duration {
+	if settings.AccessibleProjectsCacheTTL > 0 {
+		return time.Duration(settings.AccessibleProjectsCacheTTL) * time.Second
+	}
+	return accessibleProjectsCacheTTL
+}
+
+// schemaCacheTTL returns how long the table names and schemas of a data
+// source are cached
+func schemaCacheTTL(settings types.BigQuerySettings) time.Duration {
+	if settings.SchemaCacheTTL > 0 {
+		return time.Duration(settings.SchemaCacheTTL) * time.Second
+	}
+	return api.DefaultSchemaCacheTTL
+}
+
 type ConnectionArgs struct {
+	// Project is the project of the dataset, used to resolve its location
+	Project          string              `json:"project,omitempty"`
 	Dataset          string              `json:"dataset,omitempty"`
 	Table            string              `json:"table,omitempty"`
 	Location         string              `json:"location,omitempty"`
@@ -88,6 +149,7 @@ func newBigQueryDatasource() *BigQueryDatasource {
 	return &BigQueryDatasource{
 		bqFactory:               bq.NewClient,
 		resourceManagerServices: make(map[string]*cloudresourcemanager.Service),
+		allowlistVerdicts:       make(map[string]allowlistVerdictEntry),
 		logger:                  backend.Logger,
 	}
 }
@@ -121,6 +183,9 @@ func (s *BigQueryDatasource) Connect(ctx context.Context, config backend.DataSou
 			return s.accessibleProjects(ctx, config, settings)
 		}
 	}
+	if connectionSettings.ReadOnly || connectionSettings.RestrictToAccessibleDatasets {
+		connectionSettings.AllowlistVerdicts = s.newAllowlistVerdictCache(config, connectionSettings.Location, connectionSettings.Project, accessibleProjectsTTL(settings))
+	}
 
 	connectionKey := fmt.Sprintf("%s/%s:%s:%t", config.UID, connectionSettings.Location, connectionSettings.Project, connectionSettings.EnableStorageAPI)
 
@@ -192,8 +257,16 @@ func (s *BigQueryDatasource) Connect(ctx context.Context, config backend.DataSou
 
 		s.connections.Store(connectionKey, conn{db: db, driver: dr})
 
+		service, err := bqapi.NewService(ctx, options...)
+		if err != nil {
+			loggerWithContext.Warn("Failed to create bigquery service", "error", err)
+			return nil, ErrFailedToConnect
+		}
+
 		apiInstance := api.New(bqClient)
+		apiInstance.SetService(service)
 		apiInstance.SetLocation(connectionSettings.Location)
+		apiInstance.SetSchemaCacheTTL(schemaCacheTTL(settings))
 
 		s.apiClients.Store(connectionKey, apiInstance)
 		return db, nil
@@ -229,7 +302,21 @@ func (s *BigQueryDatasource) createResourceManagerService(ctx context.Context, c
 }
 
 func (s *BigQueryDatasource) Converters() (sc []sqlutil.Converter) {
-	return sc
+	return append(sc, jsonConverter)
+}
+
+// MutateQueryData attaches a collector for the field config the driver derives
+// from the BigQuery schema of each query result.
+func (s *BigQueryDatasource) MutateQueryData(ctx context.Context, req *backend.QueryDataRequest) (context.Context, *backend.QueryDataRequest) {
+	return driver.WithFieldConfigs(ctx), req
+}
+
+// MutateResponse applies the field config collected while running the queries
+func (s *BigQueryDatasource) MutateResponse(ctx context.Context, res data.Frames) (data.Frames, error) {
+	if fieldConfigs := driver.FieldConfigsFromContext(ctx); fieldConfigs != nil {
+		fieldConfigs.Apply(res)
+	}
+	return res, nil
 }
 
 func (s *BigQueryDatasource) FillMode() *data.FillMissing {
@@ -250,10 +337,25 @@ func (s *BigQueryDatasource) Settings(_ context.Context, _ backend.DataSourceIns
 type DatasetsArgs struct {
 	Project  string `json:"project"`
 	Location string `json:"location"`
+	// Filter restricts the listing to datasets with matching labels, using the
+	// BigQuery label filter syntax, e.g. "labels.env:prod labels.team"
+	Filter string `json:"filter,omitempty"`
 }
 
 func (s *BigQueryDatasource) Datasets(ctx context.Context, options DatasetsArgs) ([]string, error) {
-	if datasets, ok := s.allowlistedDatasets(ctx, options.Project); ok {
+	allowed, ok := s.allowlistedDatasets(ctx, options.Project)
+	if ok && !slices.ContainsFunc(allowed, driver.IsPattern) && options.Filter == "" {
+		return allowed, nil
+	}
+	if ok && !slices.ContainsFunc(allowed, driver.IsPattern) {
+		details, err := s.DatasetDetails(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		datasets := make([]string, 0, len(details))
+		for _, d := range details {
+			datasets = append(datasets, d.ID)
+		}
 		return datasets, nil
 	}
 
@@ -262,11 +364,98 @@ func (s *BigQueryDatasource) Datasets(ctx context.Context, options DatasetsArgs)
 		return nil, err
 	}
 
-	return apiClient.ListDatasets(ctx)
+	datasets, err := apiClient.ListDatasets(ctx, options.Filter)
+	if err != nil || !ok {
+		return datasets, err
+	}
+	return filterDatasets(datasets, allowed), nil
+}
+
+// DatasetDetails lists the datasets of a project like Datasets, along with
+// their location, description, labels, default table expiration and creation
+// time
+func (s *BigQueryDatasource) DatasetDetails(ctx context.Context, options DatasetsArgs) ([]types.DatasetInfo, error) {
+	apiClient, err := s.getApi(ctx, options.Project, options.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, ok := s.allowlistedDatasets(ctx, options.Project)
+	if ok && !slices.ContainsFunc(allowed, driver.IsPattern) {
+		// Allowlisted datasets are not listed, so the label filter is
+		// applied here instead of by BigQuery
+		filter, err := parseLabelFilter(options.Filter)
+		if err != nil {
+			return nil, err
+		}
+		details, err := apiClient.GetDatasetInfo(ctx, allowed)
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(details, func(d types.DatasetInfo) bool {
+			return !filter.matches(d.Labels)
+		}), nil
+	}
+
+	datasets, err := apiClient.ListDatasets(ctx, options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		datasets = filterDatasets(datasets, allowed)
+	}
+	return apiClient.GetDatasetInfo(ctx, datasets)
+}
+
+// labelFilter is a parsed BigQuery dataset label filter: every key must be
+// present and, when a value is given, equal it
+type labelFilter map[string]*string
+
+// parseLabelFilter parses the "labels.<key>[:<value>]" terms of a dataset
+// list filter, which are separated by spaces and all have to match
+func parseLabelFilter(filter string) (labelFilter, error) {
+	res := labelFilter{}
+	for _, term := range strings.Fields(filter) {
+		key, ok := strings.CutPrefix(term, "labels.")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid dataset label filter %q: terms must be of the form labels.<key>[:<value>]", term)
+		}
+		if key, value, hasValue := strings.Cut(key, ":"); hasValue {
+			res[key] = &value
+		} else {
+			res[key] = nil
+		}
+	}
+	return res, nil
 }
 
-// allowlistedDatasets returns the additionally allowed datasets for a project
-// that is only reachable through the allowlist, so the query builder offers
+func (f labelFilter) matches(labels map[string]string) bool {
+	for key, value := range f {
+		got, ok := labels[key]
+		if !ok || (value != nil && got != *value) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterDatasets returns the datasets matching any of the dataset patterns
+func filterDatasets(datasets []string, patterns []string) []string {
+	var res []string
+	for _, dataset := range datasets {
+		for _, pattern := range patterns {
+			if (driver.AllowedDataset{Dataset: pattern}).MatchesDataset(dataset) {
+				res = append(res, dataset)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// allowlistedDatasets returns the additionally allowed datasets, or dataset
+// patterns, for a project that is only reachable through the allowlist, so
+// the query builder offers
 // exactly the datasets that are queryable. Listing such a project directly
 // would return every dataset the credentials can see (hundreds for public data
 // projects), almost all of which would be denied at query time. Projects the
@@ -282,9 +471,9 @@ func (s *BigQueryDatasource) allowlistedDatasets(ctx context.Context, project st
 	}
 
 	var datasets []string
-	for _, entry := range parseAllowedDatasets(settings.AdditionalAllowedDatasets) {
-		if entryProject, dataset, ok := strings.Cut(entry, "."); ok && entryProject == project {
-			datasets = append(datasets, dataset)
+	for _, entry := range parseList(settings.AdditionalAllowedDatasets) {
+		if allowed, err := driver.ParseAllowedDataset(entry); err == nil && allowed.MatchesProject(project) {
+			datasets = append(datasets, allowed.Dataset)
 		}
 	}
 	if len(datasets) == 0 {
@@ -352,11 +541,13 @@ func (s *BigQueryDatasource) Columns(ctx context.Context, options sqlds.Options)
 		return nil, err
 	}
 
-	isOrderableString := options["isOrderable"]
-	isOrderable, err := strconv.ParseBool(isOrderableString)
-
-	if err != nil {
-		return nil, errors.WithMessage(err, "Failed to parse isOrderable")
+	// isOrderable is optional and defaults to false
+	isOrderable := false
+	if isOrderableString := options["isOrderable"]; isOrderableString != "" {
+		isOrderable, err = strconv.ParseBool(isOrderableString)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to parse isOrderable")
+		}
 	}
 
 	return apiClient.ListColumns(ctx, args.Dataset, args.Table, isOrderable)
@@ -364,6 +555,9 @@ func (s *BigQueryDatasource) Columns(ctx context.Context, options sqlds.Options)
 
 type ProjectsArgs struct {
 	DatasourceUid string `json:"datasourceUid"`
+	// Query is an optional resource manager search query, such as
+	// "displayName:analytics*", narrowing the projects returned
+	Query string `json:"query,omitempty"`
 }
 
 type Project struct {
@@ -408,23 +602,61 @@ func (s *BigQueryDatasource) Projects(ctx context.Context, options ProjectsArgs)
 		return nil, errors.New("resource manager service not initialized")
 	}
 
-	response, err := rmSvc.Projects.Search().Do()
+	found, err := searchProjects(ctx, rmSvc, options.Query)
 	if err != nil {
 		return nil, err
 	}
+	// Under the dataset restriction, only list the projects queries may use
+	if bqSettings.RestrictToAccessibleDatasets {
+		scope, err := parseProjectScope(bqSettings)
+		if err != nil {
+			return nil, err
+		}
+		if found, err = scope.filter(ctx, rmSvc, found); err != nil {
+			return nil, err
+		}
+	}
 
-	projects := make([]*Project, 0, len(response.Projects))
-	for _, project := range response.Projects {
+	projects := make([]*Project, 0, len(found))
+	for _, project := range found {
 		projects = append(projects, &Project{project.ProjectId, project.DisplayName})
 	}
 
+	// Allowlisted projects cannot be matched against the search query
+	if options.Query != "" {
+		return projects, nil
+	}
 	return appendAllowlistProjects(projects, bqSettings), nil
 }
 
+// projectsSearchPageSize is the number of projects requested per resource
+// manager search page
+const projectsSearchPageSize = 500
+
+// searchProjects returns the projects matching query, or every project the
+// credentials can see when query is empty, following all result pages.
+func searchProjects(ctx context.Context, rmSvc *cloudresourcemanager.Service, query string) ([]*cloudresourcemanager.Project, error) {
+	call := rmSvc.Projects.Search().PageSize(projectsSearchPageSize)
+	if query != "" {
+		call = call.Query(query)
+	}
+
+	var projects []*cloudresourcemanager.Project
+	err := call.Pages(ctx, func(page *cloudresourcemanager.SearchProjectsResponse) error {
+		projects = append(projects, page.Projects...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
 // appendAllowlistProjects adds the projects referenced by the additional
 // allowed datasets to the project list, so allowlisted datasets outside the
 // accessible projects can be reached from the query builder. Bare entries
-// belong to the default project, which is already listed.
+// belong to the default project, which is already listed. Project patterns
+// cannot be enumerated and are left out.
 func appendAllowlistProjects(projects []*Project, settings types.BigQuerySettings) []*Project {
 	if !settings.RestrictToAccessibleDatasets {
 		return projects
@@ -434,9 +666,10 @@ func appendAllowlistProjects(projects []*Project, settings types.BigQuerySetting
 	for _, project := range projects {
 		seen[project.ProjectId] = true
 	}
-	for _, entry := range parseAllowedDatasets(settings.AdditionalAllowedDatasets) {
-		project, _, ok := strings.Cut(entry, ".")
-		if !ok || seen[project] {
+	for _, entry := range parseList(settings.AdditionalAllowedDatasets) {
+		allowed, err := driver.ParseAllowedDataset(entry)
+		project := allowed.Project
+		if err != nil || project == "" || driver.IsPattern(project) || seen[project] {
 			continue
 		}
 		seen[project] = true
@@ -446,21 +679,102 @@ func appendAllowlistProjects(projects []*Project, settings types.BigQuerySetting
 }
 
 // accessibleProjects returns the GCP projects the data source credentials can
-// enumerate via the resource manager API, cached per data source. With OAuth
-// passthrough the credentials cannot enumerate projects, so only the default
-// project is returned, mirroring Projects.
+// enumerate via the resource manager API, narrowed to the configured project
+// scope. They are cached per data source for the configured TTL, or until the
+// settings are updated. Past the TTL, the last listed projects are served for
+// up to accessibleProjectsMaxStaleness while they are listed again in the
+// background. After a failure, they are not listed again for
+// accessibleProjectsRetryBackoff. With OAuth passthrough the credentials cannot
+// enumerate projects, so only the default project is returned, mirroring
+// Projects.
 func (s *BigQueryDatasource) accessibleProjects(ctx context.Context, config backend.DataSourceInstanceSettings, settings types.BigQuerySettings) ([]string, error) {
 	if settings.OAuthPassthroughEnabled {
 		return []string{settings.DefaultProject}, nil
 	}
 
-	if entry, ok := s.accessibleProjectsCache.Load(config.UID); ok {
-		cached := entry.(accessibleProjectsEntry)
-		if time.Since(cached.fetchedAt) < accessibleProjectsCacheTTL {
-			return cached.projects, nil
+	ttl := accessibleProjectsTTL(settings)
+	entry, cached := s.accessibleProjectsCache.Load(config.UID)
+	cached = cached && entry.(accessibleProjectsEntry).settingsUpdated.Equal(config.Updated)
+	if cached && time.Since(entry.(accessibleProjectsEntry).fetchedAt) < ttl {
+		return entry.(accessibleProjectsEntry).projects, nil
+	}
+	stale := cached && time.Since(entry.(accessibleProjectsEntry).fetchedAt) < ttl+accessibleProjectsMaxStaleness
+
+	failure, failed := s.accessibleProjectsErrors.Load(config.UID)
+	failed = failed && failure.(accessibleProjectsFailure).settingsUpdated.Equal(config.Updated) &&
+		time.Since(failure.(accessibleProjectsFailure).failedAt) < accessibleProjectsRetryBackoff
+	switch {
+	case stale:
+		if failed {
+			s.logger.FromContext(ctx).Warn("Failed to list accessible projects, serving the last listed projects", "error", failure.(accessibleProjectsFailure).err, "fetchedAt", entry.(accessibleProjectsEntry).fetchedAt)
+		} else {
+			// The result is only needed by later queries, through the cache
+			s.accessibleProjectsFetches.DoChan(accessibleProjectsFetchKey(config), func() (any, error) {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accessibleProjectsFetchTimeout)
+				defer cancel()
+				return s.fetchAccessibleProjects(ctx, config, settings)
+			})
+		}
+		return entry.(accessibleProjectsEntry).projects, nil
+	case failed:
+		return nil, failure.(accessibleProjectsFailure).err
+	}
+
+	projects, err, _ := s.accessibleProjectsFetches.Do(accessibleProjectsFetchKey(config), func() (any, error) {
+		return s.fetchAccessibleProjects(ctx, config, settings)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects.([]string), nil
+}
+
+// accessibleProjectsFetchKey identifies the listings of the accessible
+// projects of a data source that concurrent queries can share
+func accessibleProjectsFetchKey(config backend.DataSourceInstanceSettings) string {
+	return fmt.Sprintf("%s/%d", config.UID, config.Updated.UnixNano())
+}
+
+// RefreshAccessibleProjects lists the accessible projects of the data source
+// in the request context again, replacing the cached ones. The cached projects
+// are kept when they cannot be listed.
+func (s *BigQueryDatasource) RefreshAccessibleProjects(ctx context.Context) ([]string, error) {
+	dsSettings := getDatasourceSettings(ctx)
+	if dsSettings == nil {
+		return nil, errors.New("missing datasource settings in context")
+	}
+
+	settings, err := loadSettings(dsSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.OAuthPassthroughEnabled {
+		return []string{settings.DefaultProject}, nil
+	}
+	return s.fetchAccessibleProjects(ctx, *dsSettings, settings)
+}
+
+// fetchAccessibleProjects lists the accessible projects and caches them, or
+// records the failure to list them
+func (s *BigQueryDatasource) fetchAccessibleProjects(ctx context.Context, config backend.DataSourceInstanceSettings, settings types.BigQuerySettings) ([]string, error) {
+	projects, err := s.listAccessibleProjects(ctx, config, settings)
+	if err != nil {
+		// A cancelled request says nothing about the resource manager
+		if ctx.Err() == nil {
+			s.accessibleProjectsErrors.Store(config.UID, accessibleProjectsFailure{err: err, failedAt: time.Now(), settingsUpdated: config.Updated})
 		}
+		return nil, err
 	}
 
+	s.accessibleProjectsErrors.Delete(config.UID)
+	s.accessibleProjectsCache.Store(config.UID, accessibleProjectsEntry{projects: projects, fetchedAt: time.Now(), settingsUpdated: config.Updated})
+	return projects, nil
+}
+
+// listAccessibleProjects lists the accessible projects from the resource
+// manager API
+func (s *BigQueryDatasource) listAccessibleProjects(ctx context.Context, config backend.DataSourceInstanceSettings, settings types.BigQuerySettings) ([]string, error) {
 	rmSvc := s.getResourceManagerService(config.UID)
 	if rmSvc == nil {
 		if err := s.createResourceManagerService(ctx, config, settings, config.UID); err != nil {
@@ -472,17 +786,22 @@ func (s *BigQueryDatasource) accessibleProjects(ctx context.Context, config back
 		}
 	}
 
-	response, err := rmSvc.Projects.Search().Context(ctx).Do()
+	scope, err := parseProjectScope(settings)
 	if err != nil {
 		return nil, err
 	}
+	found, err := searchProjects(ctx, rmSvc, "")
+	if err != nil {
+		return nil, err
+	}
+	if found, err = scope.filter(ctx, rmSvc, found); err != nil {
+		return nil, err
+	}
 
-	projects := make([]string, 0, len(response.Projects))
-	for _, project := range response.Projects {
+	projects := make([]string, 0, len(found))
+	for _, project := range found {
 		projects = append(projects, project.ProjectId)
 	}
-
-	s.accessibleProjectsCache.Store(config.UID, accessibleProjectsEntry{projects: projects, fetchedAt: time.Now()})
 	return projects, nil
 }
 
@@ -517,34 +836,52 @@ func (s *BigQueryDatasource) ValidateQuery(ctx context.Context, options Validate
 
 	response := apiClient.ValidateQuery(ctx, query)
 
-	// Surface dataset restriction denials in the query editor. This is a
-	// convenience only; enforcement happens in the driver on every execution.
+	// Surface read-only and dataset restriction denials in the query editor.
+	// This is a convenience only; enforcement happens in the driver on every
+	// execution.
 	if dsSettings := getDatasourceSettings(ctx); response.IsValid && dsSettings != nil {
 		settings, err := loadSettings(dsSettings)
 		if err != nil {
 			return response, nil
 		}
-		if settings.RestrictToAccessibleDatasets {
+		var stats *bq.QueryStatistics
+		if response.Statistics != nil {
+			stats, _ = response.Statistics.Details.(*bq.QueryStatistics)
+		}
+		var checkErr error
+		if settings.ReadOnly {
+			checkErr = driver.CheckStatementType(stats, parseList(settings.AllowedStatementTypes))
+		}
+		if checkErr == nil && settings.RestrictToAccessibleDatasets {
 			// With GCE authentication the default project is resolved per
 			// query, so fall back to the project the editor is targeting.
 			defaultProject := settings.DefaultProject
 			if defaultProject == "" {
 				defaultProject = options.Project
 			}
-			var stats *bq.QueryStatistics
-			if response.Statistics != nil {
-				stats, _ = response.Statistics.Details.(*bq.QueryStatistics)
-			}
 			accessibleProjects, projectsErr := s.accessibleProjects(ctx, *dsSettings, settings)
-			checkErr := driver.CheckAllowedDatasets(stats, accessibleProjects, parseAllowedDatasets(settings.AdditionalAllowedDatasets), defaultProject)
+			dryRun := func(ctx context.Context, query string) (*bq.QueryStatistics, error) {
+				statementResponse := apiClient.ValidateQuery(ctx, query)
+				if statementResponse.IsError {
+					return nil, errors.New(statementResponse.Error)
+				}
+				var stats *bq.QueryStatistics
+				if statementResponse.Statistics != nil {
+					stats, _ = statementResponse.Statistics.Details.(*bq.QueryStatistics)
+				}
+				return stats, nil
+			}
+			checkErr = driver.CheckAllowedQuery(ctx, stats, query, dryRun, func(stats *bq.QueryStatistics, query string) error {
+				return driver.CheckAllowedDatasets(stats, query, accessibleProjects, parseList(settings.AdditionalAllowedDatasets), parseList(settings.DeniedTables), defaultProject)
+			})
 			if checkErr != nil && projectsErr != nil {
 				checkErr = fmt.Errorf("%s (could not list accessible projects: %s)", checkErr, projectsErr)
 			}
-			if checkErr != nil {
-				response.IsValid = false
-				response.IsError = true
-				response.Error = checkErr.Error()
-			}
+		}
+		if checkErr != nil {
+			response.IsValid = false
+			response.IsError = true
+			response.Error = checkErr.Error()
 		}
 	}
 
@@ -575,8 +912,287 @@ func (s *BigQueryDatasource) TableSchema(ctx context.Context, args TableSchemaAr
 	return apiClient.GetTableSchema(ctx, args.Dataset, args.Table)
 }
 
+type TableColumnsArgs struct {
+	Project  string `json:"project"`
+	Location string `json:"location"`
+	Dataset  string `json:"dataset"`
+	Table    string `json:"table"`
+	ut.ColumnFilter
+}
+
+// TableColumns returns the typed columns of a table, optionally narrowed to
+// the columns usable in ORDER BY, GROUP BY or as a time field
+func (s *BigQueryDatasource) TableColumns(ctx context.Context, args TableColumnsArgs) ([]types.ColumnMetadata, error) {
+	if args.Project == "" || args.Dataset == "" || args.Table == "" {
+		return nil, errors.New("missing required arguments")
+	}
+
+	apiClient, err := s.getApi(ctx, args.Project, args.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiClient.ListColumnMetadata(ctx, args.Dataset, args.Table, args.ColumnFilter)
+}
+
+type RoutinesArgs struct {
+	Project  string `json:"project"`
+	Location string `json:"location"`
+	Dataset  string `json:"dataset"`
+}
+
+// Routines returns the user-defined functions, table functions and stored
+// procedures of a dataset, for autocompletion in the SQL editor
+func (s *BigQueryDatasource) Routines(ctx context.Context, args RoutinesArgs) ([]types.Routine, error) {
+	if args.Project == "" || args.Dataset == "" {
+		return nil, errors.New("missing required arguments")
+	}
+
+	apiClient, err := s.getApi(ctx, args.Project, args.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiClient.ListRoutines(ctx, args.Dataset)
+}
+
+type ModelsArgs struct {
+	Project  string `json:"project"`
+	Location string `json:"location"`
+	Dataset  string `json:"dataset"`
+}
+
+// Models returns the BigQuery ML models of a dataset, so ML.PREDICT and
+// ML.FORECAST queries can be built from the editor
+func (s *BigQueryDatasource) Models(ctx context.Context, args ModelsArgs) ([]types.Model, error) {
+	if args.Project == "" || args.Dataset == "" {
+		return nil, errors.New("missing required arguments")
+	}
+
+	apiClient, err := s.getApi(ctx, args.Project, args.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiClient.ListModels(ctx, args.Dataset)
+}
+
+type SchemaSearchArgs struct {
+	Project  string `json:"project"`
+	Location string `json:"location"`
+	// Query is the text table and column names are searched for
+	Query string `json:"query"`
+	// Limit is the maximum number of results, defaultSchemaSearchResults when
+	// not set
+	Limit int `json:"limit,omitempty"`
+}
+
+// defaultSchemaSearchResults is the number of results a schema search returns
+// by default
+const defaultSchemaSearchResults = 100
+
+// SearchSchema finds the tables and columns of a project whose name contains
+// the query, across all its datasets in a location, which defaults to the
+// processing location of the data source. With the dataset restriction
+// enabled, tables the data source may not query are left out.
+func (s *BigQueryDatasource) SearchSchema(ctx context.Context, args SchemaSearchArgs) ([]types.SchemaSearchResult, error) {
+	if args.Project == "" || strings.TrimSpace(args.Query) == "" {
+		return nil, errors.New("missing required arguments")
+	}
+	dsSettings := getDatasourceSettings(ctx)
+	if dsSettings == nil {
+		return nil, errors.New("missing datasource settings in context")
+	}
+	settings, err := loadSettings(dsSettings)
+	if err != nil {
+		return nil, err
+	}
+	location := cmp.Or(args.Location, settings.ProcessingLocation)
+	if location == "" {
+		return nil, backend.DownstreamError(errors.New("a location is required to search the schema, as the data source has no processing location"))
+	}
+	limit := cmp.Or(args.Limit, defaultSchemaSearchResults)
+
+	apiClient, err := s.getApi(ctx, args.Project, location)
+	if err != nil {
+		return nil, err
+	}
+
+	restriction, err := s.schemaSearchRestriction(ctx, *dsSettings, settings, args.Project)
+	if err != nil {
+		return nil, err
+	}
+	return apiClient.SearchSchema(ctx, location, strings.TrimSpace(args.Query), limit, restriction)
+}
+
+// schemaSearchRestriction returns the tables of a project a schema search may
+// return, or nil when datasets are not restricted. These are the tables
+// tableRestriction allows, as patterns the search filters on in SQL.
+func (s *BigQueryDatasource) schemaSearchRestriction(ctx context.Context, config backend.DataSourceInstanceSettings, settings types.BigQuerySettings, project string) (*api.SchemaSearchRestriction, error) {
+	if !settings.RestrictToAccessibleDatasets {
+		return nil, nil
+	}
+
+	restriction := &api.SchemaSearchRestriction{}
+	accessibleProjects, err := s.accessibleProjects(ctx, config, settings)
+	if err != nil {
+		s.logger.FromContext(ctx).Warn("Failed to list accessible projects, searching the additional allowed datasets only", "error", err)
+	}
+	if !slices.Contains(accessibleProjects, project) {
+		restriction.Allowed = []api.TablePattern{}
+		for _, entry := range parseList(settings.AdditionalAllowedDatasets) {
+			allowed, err := driver.ParseAllowedDataset(entry)
+			if err != nil {
+				// An invalid entry never allows anything
+				continue
+			}
+			if allowed.Project == "" {
+				allowed.Project = cmp.Or(settings.DefaultProject, project)
+			}
+			if !allowed.MatchesProject(project) {
+				continue
+			}
+			if pattern, err := tablePattern(allowed); err == nil {
+				restriction.Allowed = append(restriction.Allowed, pattern)
+			}
+		}
+	}
+
+	for _, entry := range parseList(settings.DeniedTables) {
+		denied, err := driver.ParseDeniedTable(entry)
+		if err == nil && !denied.MatchesProject(project) {
+			continue
+		}
+		var pattern api.TablePattern
+		if err == nil {
+			pattern, err = tablePattern(denied)
+		}
+		if err != nil {
+			// Deny rules must not be weakened by a typo
+			return nil, backend.DownstreamError(fmt.Errorf("the denied table entry %q is invalid: %w", entry, err))
+		}
+		restriction.Denied = append(restriction.Denied, pattern)
+	}
+	return restriction, nil
+}
+
+// tablePattern returns the pattern of the tables an allowed dataset or denied
+// table entry matches in its project
+func tablePattern(entry driver.AllowedDataset) (api.TablePattern, error) {
+	dataset, err := driver.PatternRegexp(entry.Dataset)
+	if err != nil {
+		return api.TablePattern{}, err
+	}
+	table, err := driver.PatternRegexp(entry.Table)
+	if err != nil {
+		return api.TablePattern{}, err
+	}
+	return api.TablePattern{Dataset: dataset, Table: table}, nil
+}
+
+type TablePreviewArgs struct {
+	Project  string   `json:"project"`
+	Location string   `json:"location"`
+	Dataset  string   `json:"dataset"`
+	Table    string   `json:"table"`
+	Columns  []string `json:"columns,omitempty"`
+	// Limit is the number of rows to read, defaultPreviewRows when not set
+	Limit int `json:"limit,omitempty"`
+}
+
+// defaultPreviewRows is the number of rows a table preview reads by default
+const defaultPreviewRows = 10
+
+// TablePreview reads the first rows of a table without running a query, so
+// previewing a table is not billed
+func (s *BigQueryDatasource) TablePreview(ctx context.Context, args TablePreviewArgs) (*data.Frame, error) {
+	if args.Project == "" || args.Dataset == "" || args.Table == "" {
+		return nil, errors.New("missing required arguments")
+	}
+
+	if err := s.checkTableAllowed(ctx, args.Project, args.Dataset, args.Table); err != nil {
+		return nil, err
+	}
+
+	apiClient, err := s.getApi(ctx, args.Project, args.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := args.Limit
+	if limit == 0 {
+		limit = defaultPreviewRows
+	}
+	return apiClient.PreviewTable(ctx, args.Dataset, args.Table, args.Columns, limit)
+}
+
+// checkTableAllowed applies the dataset restriction to a table read without
+// a query, as if a query referenced it
+func (s *BigQueryDatasource) checkTableAllowed(ctx context.Context, project, dataset, table string) error {
+	check, err := s.tableRestriction(ctx, project)
+	if err != nil || check == nil {
+		return err
+	}
+	return check(dataset, table)
+}
+
+// tableRestriction returns the check applying the dataset restriction to the
+// tables of project read without a query, or nil when the restriction is
+// disabled. The settings and accessible projects are loaded once, so one
+// check serves any number of tables.
+func (s *BigQueryDatasource) tableRestriction(ctx context.Context, project string) (func(dataset, table string) error, error) {
+	dsSettings := getDatasourceSettings(ctx)
+	if dsSettings == nil {
+		return nil, errors.New("missing datasource settings in context")
+	}
+
+	settings, err := loadSettings(dsSettings)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.RestrictToAccessibleDatasets {
+		return nil, nil
+	}
+
+	// With GCE authentication the default project is resolved per query, so
+	// fall back to the project of the table.
+	defaultProject := settings.DefaultProject
+	if defaultProject == "" {
+		defaultProject = project
+	}
+	accessibleProjects, projectsErr := s.accessibleProjects(ctx, *dsSettings, settings)
+	additionalDatasets := parseList(settings.AdditionalAllowedDatasets)
+	deniedTables := parseList(settings.DeniedTables)
+
+	return func(dataset, table string) error {
+		// A partition decorator, snapshot decorator or wildcard would be checked
+		// against the denied tables under a name that is not the table's
+		if strings.ContainsAny(table, "$@*") {
+			return backend.DownstreamError(fmt.Errorf("table %s.%s.%s cannot be read: table decorators and wildcards are not allowed when datasets are restricted", project, dataset, table))
+		}
+
+		stats := &bq.QueryStatistics{
+			StatementType:    "SELECT",
+			ReferencedTables: []*bq.Table{{ProjectID: project, DatasetID: dataset, TableID: table}},
+		}
+		checkErr := driver.CheckAllowedDatasets(stats, "", accessibleProjects, additionalDatasets, deniedTables, defaultProject)
+		if checkErr != nil && projectsErr != nil {
+			checkErr = fmt.Errorf("%w (could not list accessible projects: %s)", checkErr, projectsErr)
+		}
+		if checkErr != nil {
+			return backend.DownstreamError(checkErr)
+		}
+		return nil
+	}, nil
+}
+
 func (s *BigQueryDatasource) getApi(ctx context.Context, project, location string) (*api.API, error) {
-	datasourceSettings := getDatasourceSettings(ctx)
+	return s.newApi(ctx, getDatasourceSettings(ctx), project, location)
+}
+
+// newApi returns the API client of a data source for a project and location,
+// creating it on first use
+func (s *BigQueryDatasource) newApi(ctx context.Context, datasourceSettings *backend.DataSourceInstanceSettings, project, location string) (*api.API, error) {
 	connectionKey := fmt.Sprintf("%s/%s:%s", datasourceSettings.UID, location, project)
 	cClient, exists := s.apiClients.Load(connectionKey)
 
@@ -608,9 +1224,15 @@ func (s *BigQueryDatasource) getApi(ctx context.Context, project, location strin
 	if err != nil {
 		return nil, err
 	}
+	service, err := bqapi.NewService(ctx, clientOptions...)
+	if err != nil {
+		return nil, err
+	}
 	apiInstance := api.New(client)
 
+	apiInstance.SetService(service)
 	apiInstance.SetLocation(location)
+	apiInstance.SetSchemaCacheTTL(schemaCacheTTL(settings))
 
 	s.apiClients.Store(connectionKey, apiInstance)
 
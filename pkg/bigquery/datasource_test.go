@@ -4,11 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
 	bq "cloud.google.com/go/bigquery"
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/api"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/bqtest"
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
@@ -17,6 +22,7 @@ import (
 	"github.com/grafana/sqlds/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bqapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/api/cloudresourcemanager/v3"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc/metadata"
@@ -158,6 +164,127 @@ func Test_datasourceConnection(t *testing.T) {
 	})
 }
 
+func Test_datasourceConnection_datasetLocation(t *testing.T) {
+	var lookups []string
+	var locations []string
+	euLocation := "EU"
+	dataset := func(project, dataset string, location *string) func(*http.Request) any {
+		return func(r *http.Request) any {
+			lookups = append(lookups, r.URL.Path)
+			return bqapi.Dataset{DatasetReference: &bqapi.DatasetReference{ProjectId: project, DatasetId: dataset}, Location: *location}
+		}
+	}
+	asiaLocation := "asia-northeast1"
+	server := bqtest.NewServer(t, map[string]any{
+		"/projects/raintank-dev/datasets/sales_eu":    dataset("raintank-dev", "sales_eu", &euLocation),
+		"/projects/other-project/datasets/sales_asia": dataset("other-project", "sales_asia", &asiaLocation),
+		"/projects/raintank-dev/datasets/missing": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lookups = append(lookups, r.URL.Path)
+			http.NotFound(w, r)
+		}),
+		"/projects/raintank-dev/jobs": func(r *http.Request) any {
+			var job bqapi.Job
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&job))
+			locations = append(locations, job.JobReference.Location)
+			job.JobReference.JobId = "job"
+			job.Status = &bqapi.JobStatus{State: "DONE"}
+			return job
+		},
+		"/projects/raintank-dev/jobs/job":    bqapi.Job{Status: &bqapi.JobStatus{State: "DONE"}, Statistics: &bqapi.JobStatistics{Query: &bqapi.JobStatistics2{StatementType: "SELECT"}}},
+		"/projects/raintank-dev/queries/job": bqtest.QueryResponse("raintank-dev", []*bqapi.TableFieldSchema{{Name: "n", Type: "INTEGER"}}, []any{"1"}),
+	})
+
+	settings := backend.DataSourceInstanceSettings{
+		ID:  1,
+		UID: "uid-1",
+		DecryptedSecureJSONData: map[string]string{
+			"privateKey": "randomPrivateKey",
+		},
+		JSONData: []byte(`{"authenticationType":"jwt","defaultProject": "raintank-dev","tokenUri":"token","clientEmail":"test@grafana.com"}`),
+	}
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{DataSourceInstanceSettings: &settings}
+	}
+
+	ds := &BigQueryDatasource{
+		bqFactory: func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bq.Client, error) {
+			return bq.NewClient(ctx, projectID, bqtest.ClientOptions(server)...)
+		},
+		resourceManagerServices: make(map[string]*cloudresourcemanager.Service),
+		logger:                  backend.NewLoggerWith("bigquery datasource"),
+	}
+	sqlDatasource := sqlds.NewDatasource(ds)
+	sqlDatasource.EnableMultipleConnections = true
+	instance, err := sqlDatasource.NewDatasource(t.Context(), settings)
+	require.NoError(t, err)
+
+	// runQuery runs a query through sqlds and returns the location it ran in
+	runQuery := func(t *testing.T, connectionArgs string) string {
+		t.Helper()
+		locations = nil
+		res, err := instance.(*sqlds.SQLDatasource).QueryData(t.Context(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+			Queries: []backend.DataQuery{{
+				RefID: "A",
+				JSON:  []byte(`{"rawSql": "SELECT 1", "format": 1, "connectionArgs": ` + connectionArgs + `}`),
+			}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+		require.Len(t, locations, 1)
+		return locations[0]
+	}
+
+	t.Run("resolves and caches the location of the dataset", func(t *testing.T) {
+		assert.Equal(t, "EU", runQuery(t, `{"dataset": "sales_eu"}`))
+		assert.Equal(t, "EU", runQuery(t, `{"dataset": "sales_eu"}`))
+
+		_, exists := ds.connections.Load("uid-1/EU:raintank-dev:false")
+		assert.True(t, exists)
+		assert.Len(t, lookups, 1)
+	})
+
+	t.Run("looks the dataset up in its own project", func(t *testing.T) {
+		assert.Equal(t, "asia-northeast1", runQuery(t, `{"project": "other-project", "dataset": "sales_asia"}`))
+	})
+
+	t.Run("keeps an explicit location", func(t *testing.T) {
+		lookups = nil
+		assert.Equal(t, "US", runQuery(t, `{"dataset": "sales_asia", "location": "US"}`))
+		assert.Empty(t, lookups)
+	})
+
+	t.Run("falls back to the default location when the dataset cannot be found", func(t *testing.T) {
+		lookups = nil
+		assert.Empty(t, runQuery(t, `{"dataset": "missing"}`))
+
+		// The failure is cached briefly
+		assert.Empty(t, runQuery(t, `{"dataset": "missing"}`))
+		assert.Len(t, lookups, 1)
+	})
+
+	t.Run("looks the location up again once it expires", func(t *testing.T) {
+		lookups = nil
+		// The dataset was recreated in another location
+		euLocation = "europe-west1"
+		assert.Equal(t, "EU", runQuery(t, `{"dataset": "sales_eu"}`))
+
+		for _, key := range []string{"uid-1/raintank-dev.sales_eu", "uid-1/raintank-dev.missing"} {
+			entry, ok := ds.datasetLocations.Load(key)
+			require.True(t, ok, key)
+			expired := entry.(datasetLocationEntry)
+			expired.expires = time.Now()
+			ds.datasetLocations.Store(key, expired)
+		}
+
+		assert.Equal(t, "europe-west1", runQuery(t, `{"dataset": "sales_eu"}`))
+		assert.Empty(t, runQuery(t, `{"dataset": "missing"}`))
+		assert.Len(t, lookups, 2)
+	})
+}
+
 func Test_Projects_doesNotPanicWhenResourceManagerServiceMissing(t *testing.T) {
 	origPluginConfigFromContext := PluginConfigFromContext
 	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
@@ -201,6 +328,304 @@ func Test_Projects_doesNotPanicWhenResourceManagerServiceMissing(t *testing.T) {
 	})
 }
 
+// newPagedResourceManagerService returns a resource manager service backed by
+// a server listing projects two per page. Requests are recorded in queries.
+func newPagedResourceManagerService(t *testing.T, projectIDs []string, queries *[]string) *cloudresourcemanager.Service {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.Query().Get("query"))
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			_, err := fmt.Sscan(token, &start)
+			require.NoError(t, err)
+		}
+		end := min(start+2, len(projectIDs))
+		response := cloudresourcemanager.SearchProjectsResponse{}
+		for _, id := range projectIDs[start:end] {
+			response.Projects = append(response.Projects, &cloudresourcemanager.Project{ProjectId: id, DisplayName: "Project " + id})
+		}
+		if end < len(projectIDs) {
+			response.NextPageToken = fmt.Sprint(end)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+
+	rmSvc, err := cloudresourcemanager.NewService(t.Context(), option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+	return rmSvc
+}
+
+func Test_Projects_followsAllPages(t *testing.T) {
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				ID:       1,
+				UID:      "uid-1",
+				JSONData: []byte(`{"authenticationType":"jwt","restrictToAccessibleDatasets":true,"additionalAllowedDatasets":"bigquery-public-data.samples"}`),
+			},
+		}
+	}
+
+	var queries []string
+	ds := newBigQueryDatasource()
+	ds.resourceManagerServices["uid-1"] = newPagedResourceManagerService(t, []string{"p1", "p2", "p3", "p4", "p5"}, &queries)
+
+	projects, err := ds.Projects(t.Context(), ProjectsArgs{DatasourceUid: "uid-1"})
+	require.NoError(t, err)
+	ids := make([]string, 0, len(projects))
+	for _, project := range projects {
+		ids = append(ids, project.ProjectId)
+	}
+	assert.Equal(t, []string{"p1", "p2", "p3", "p4", "p5", "bigquery-public-data"}, ids)
+	assert.Equal(t, []string{"", "", ""}, queries)
+
+	// The search query is passed on, and allowlisted projects are left out
+	queries = nil
+	projects, err = ds.Projects(t.Context(), ProjectsArgs{Query: "displayName:Project*"})
+	require.NoError(t, err)
+	assert.Len(t, projects, 5)
+	assert.Equal(t, []string{"displayName:Project*", "displayName:Project*", "displayName:Project*"}, queries)
+
+	// The accessible projects are built from every page
+	queries = nil
+	settings, err := loadSettings(PluginConfigFromContext(t.Context()).DataSourceInstanceSettings)
+	require.NoError(t, err)
+	accessible, err := ds.accessibleProjects(t.Context(), backend.DataSourceInstanceSettings{UID: "uid-1"}, settings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p1", "p2", "p3", "p4", "p5"}, accessible)
+	assert.Len(t, queries, 3)
+}
+
+func Test_accessibleProjects_cache(t *testing.T) {
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	config := backend.DataSourceInstanceSettings{ID: 1, UID: "uid-1", JSONData: []byte(`{"authenticationType":"jwt"}`)}
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{DataSourceInstanceSettings: &config}
+	}
+	cachedAt := func(ds *BigQueryDatasource, age time.Duration) {
+		ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"cached"}, fetchedAt: time.Now().Add(-age)})
+	}
+
+	t.Run("the TTL is configurable", func(t *testing.T) {
+		var queries []string
+		ds := newBigQueryDatasource()
+		ds.resourceManagerServices["uid-1"] = newPagedResourceManagerService(t, []string{"p1"}, &queries)
+		cachedAt(ds, 10*time.Minute)
+
+		projects, err := ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{AccessibleProjectsCacheTTL: 3600})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cached"}, projects)
+		assert.Empty(t, queries)
+
+		// Past the TTL, the last listed projects are served while they are
+		// listed again in the background
+		projects, err = ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cached"}, projects)
+		assert.Eventually(t, func() bool {
+			entry, _ := ds.accessibleProjectsCache.Load("uid-1")
+			return slices.Equal(entry.(accessibleProjectsEntry).projects, []string{"p1"})
+		}, 5*time.Second, 10*time.Millisecond)
+		projects, err = ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"p1"}, projects)
+		assert.Len(t, queries, 1)
+	})
+
+	t.Run("failures are not retried before the backoff", func(t *testing.T) {
+		var queries []string
+		// Incomplete settings: the resource manager client cannot be created
+		ds := newBigQueryDatasource()
+		_, err := ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{AuthenticationType: "jwt"})
+		require.Error(t, err)
+
+		ds.resourceManagerServices["uid-1"] = newPagedResourceManagerService(t, []string{"p1"}, &queries)
+		_, err = ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{})
+		assert.Error(t, err)
+		assert.Empty(t, queries)
+
+		failure, _ := ds.accessibleProjectsErrors.Load("uid-1")
+		ds.accessibleProjectsErrors.Store("uid-1", accessibleProjectsFailure{err: failure.(accessibleProjectsFailure).err, failedAt: time.Now().Add(-accessibleProjectsRetryBackoff)})
+		projects, err := ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"p1"}, projects)
+		assert.Len(t, queries, 1)
+	})
+
+	t.Run("the last listed projects are served while they cannot be listed", func(t *testing.T) {
+		// Incomplete settings: the resource manager client cannot be created
+		ds := newBigQueryDatasource()
+		cachedAt(ds, 10*time.Minute)
+		projects, err := ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{AuthenticationType: "jwt"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cached"}, projects)
+
+		cachedAt(ds, accessibleProjectsCacheTTL+accessibleProjectsMaxStaleness)
+		_, err = ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{AuthenticationType: "jwt"})
+		assert.Error(t, err)
+	})
+
+	t.Run("refresh lists the projects again", func(t *testing.T) {
+		var queries []string
+		ds := newBigQueryDatasource()
+		ds.resourceManagerServices["uid-1"] = newPagedResourceManagerService(t, []string{"p1", "p2", "p3"}, &queries)
+		cachedAt(ds, 0)
+
+		projects, err := ds.RefreshAccessibleProjects(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"p1", "p2", "p3"}, projects)
+		projects, err = ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"p1", "p2", "p3"}, projects)
+		assert.Len(t, queries, 2)
+	})
+
+	t.Run("failed refresh keeps the cached projects", func(t *testing.T) {
+		ds := newBigQueryDatasource()
+		cachedAt(ds, 0)
+		_, err := ds.RefreshAccessibleProjects(t.Context())
+		assert.Error(t, err)
+		projects, err := ds.accessibleProjects(t.Context(), config, types.BigQuerySettings{AuthenticationType: "jwt"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cached"}, projects)
+	})
+}
+
+func Test_TablePreview_datasetRestriction(t *testing.T) {
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			ID:       1,
+			UID:      "uid-1",
+			JSONData: []byte(`{"authenticationType":"jwt","defaultProject":"myproject","restrictToAccessibleDatasets":true,"deniedTables":"myproject.sales.customers"}`),
+		}}
+	}
+	ds := newBigQueryDatasource()
+	ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"myproject"}, fetchedAt: time.Now()})
+
+	_, err := ds.TablePreview(t.Context(), TablePreviewArgs{Project: "bigquery-public-data", Dataset: "samples", Table: "shakespeare"})
+	assert.ErrorContains(t, err, "outside the projects accessible to this data source")
+	_, err = ds.TablePreview(t.Context(), TablePreviewArgs{Project: "myproject", Dataset: "sales", Table: "customers"})
+	assert.ErrorContains(t, err, "which is denied by this data source")
+	assert.NoError(t, ds.checkTableAllowed(t.Context(), "myproject", "sales", "orders"))
+	// Decorators would slip past the denied tables
+	for _, table := range []string{"customers$20240101", "customers$__UNPARTITIONED__", "customers@1700000000000", "cust*"} {
+		_, err = ds.TablePreview(t.Context(), TablePreviewArgs{Project: "myproject", Dataset: "sales", Table: table})
+		assert.ErrorContains(t, err, "table decorators and wildcards are not allowed", table)
+	}
+
+	_, err = ds.TablePreview(t.Context(), TablePreviewArgs{Project: "myproject", Dataset: "sales"})
+	assert.ErrorContains(t, err, "missing required arguments")
+}
+
+func Test_SearchSchema(t *testing.T) {
+	var requests []bqapi.QueryRequest
+	queries := func(r *http.Request) any {
+		var request bqapi.QueryRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		return bqtest.QueryResponse("myproject", []*bqapi.TableFieldSchema{
+			{Name: "table_schema", Type: "STRING"},
+			{Name: "table_name", Type: "STRING"},
+			{Name: "table_type", Type: "STRING"},
+			{Name: "column_name", Type: "STRING"},
+			{Name: "data_type", Type: "STRING"},
+		},
+			[]any{"sales", "orders", "BASE TABLE", "customer_id", "INT64"},
+		)
+	}
+	server := bqtest.NewServer(t, map[string]any{
+		"/projects/myproject/queries":    queries,
+		"/projects/shared-data/queries":  queries,
+		"/projects/private-data/queries": queries,
+	})
+	parameters := func(request bqapi.QueryRequest) map[string]*bqapi.QueryParameterValue {
+		values := map[string]*bqapi.QueryParameterValue{}
+		for _, parameter := range request.QueryParameters {
+			values[parameter.Name] = parameter.ParameterValue
+		}
+		return values
+	}
+
+	jsonData := `{"authenticationType":"jwt","defaultProject":"myproject","tokenUri":"token","clientEmail":"test@grafana.com","processingLocation":"EU","restrictToAccessibleDatasets":true,"additionalAllowedDatasets":"shared-data.public_*","deniedTables":"myproject.crm.*"}`
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			ID:  1,
+			UID: "uid-1",
+			DecryptedSecureJSONData: map[string]string{
+				"privateKey": "randomPrivateKey",
+			},
+			JSONData: []byte(jsonData),
+		}}
+	}
+	ds := newBigQueryDatasource()
+	ds.bqFactory = func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bq.Client, error) {
+		return bq.NewClient(ctx, projectID, bqtest.ClientOptions(server)...)
+	}
+	ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"myproject"}, fetchedAt: time.Now()})
+
+	t.Run("filters the denied tables and limits the results in SQL", func(t *testing.T) {
+		requests = nil
+		results, err := ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "myproject", Location: "asia-northeast1", Query: " customer ", Limit: 5})
+		require.NoError(t, err)
+		assert.Equal(t, []types.SchemaSearchResult{
+			{Dataset: "sales", Table: "orders", TableType: "BASE TABLE", Column: "customer_id", Type: "INT64"},
+		}, results)
+
+		require.Len(t, requests, 1)
+		request := requests[0]
+		assert.Contains(t, request.Query, "`myproject`.`region-asia-northeast1`.INFORMATION_SCHEMA.COLUMNS")
+		assert.Contains(t, request.Query, "LIMIT @limit")
+		assert.NotContains(t, request.Query, "@allowed")
+		assert.Equal(t, "asia-northeast1", request.Location)
+		assert.Equal(t, int64(1<<30), request.MaximumBytesBilled)
+		values := parameters(request)
+		assert.Equal(t, "customer", values["term"].Value)
+		assert.Equal(t, "5", values["limit"].Value)
+		require.Len(t, values["denied"].ArrayValues, 1)
+		assert.Equal(t, "^crm$", values["denied"].ArrayValues[0].StructValues["dataset"].Value)
+		assert.Equal(t, "^[^/]*$", values["denied"].ArrayValues[0].StructValues["table"].Value)
+	})
+
+	t.Run("searches the allowed datasets of other projects only", func(t *testing.T) {
+		requests = nil
+		_, err := ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "shared-data", Query: "customer"})
+		require.NoError(t, err)
+
+		require.Len(t, requests, 1)
+		assert.Equal(t, "EU", requests[0].Location)
+		assert.NotContains(t, requests[0].Query, "@denied")
+		values := parameters(requests[0])
+		assert.Equal(t, "100", values["limit"].Value)
+		require.Len(t, values["allowed"].ArrayValues, 1)
+		assert.Equal(t, "^public_[^/]*$", values["allowed"].ArrayValues[0].StructValues["dataset"].Value)
+		assert.Equal(t, "^.*$", values["allowed"].ArrayValues[0].StructValues["table"].Value)
+
+		requests = nil
+		results, err := ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "private-data", Query: "customer"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Empty(t, requests)
+	})
+
+	t.Run("requires a location", func(t *testing.T) {
+		_, err := ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "myproject", Location: "EU`; DROP", Query: "customer"})
+		assert.ErrorContains(t, err, "invalid location")
+		_, err = ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "myproject"})
+		assert.ErrorContains(t, err, "missing required arguments")
+
+		jsonData = `{"authenticationType":"jwt","defaultProject":"myproject","tokenUri":"token","clientEmail":"test@grafana.com"}`
+		_, err = ds.SearchSchema(t.Context(), SchemaSearchArgs{Project: "myproject", Query: "customer"})
+		assert.ErrorContains(t, err, "a location is required")
+	})
+}
+
 func Test_appendAllowlistProjects(t *testing.T) {
 	accessible := []*Project{{ProjectId: "myproject", DisplayName: "My project"}}
 
@@ -229,6 +654,17 @@ func Test_appendAllowlistProjects(t *testing.T) {
 		}
 		assert.Equal(t, accessible, appendAllowlistProjects(accessible, settings))
 	})
+
+	t.Run("skips project patterns", func(t *testing.T) {
+		settings := types.BigQuerySettings{
+			RestrictToAccessibleDatasets: true,
+			AdditionalAllowedDatasets:    "analytics-*.reporting_*, public-data.*",
+		}
+		assert.Equal(t, []*Project{
+			{ProjectId: "myproject", DisplayName: "My project"},
+			{ProjectId: "public-data", DisplayName: "public-data"},
+		}, appendAllowlistProjects(accessible, settings))
+	})
 }
 
 func Test_allowlistedDatasets(t *testing.T) {
@@ -290,6 +726,34 @@ func Test_allowlistedDatasets(t *testing.T) {
 		assert.True(t, ok)
 		assert.Equal(t, []string{"samples"}, datasets)
 	})
+
+	t.Run("project patterns match allowlist-only projects", func(t *testing.T) {
+		setJSONData(`{"authenticationType":"jwt","restrictToAccessibleDatasets":true,"additionalAllowedDatasets":"analytics-*.reporting_*, analytics-eu.events"}`)
+		datasets, ok := newDS([]string{"myproject"}).allowlistedDatasets(t.Context(), "analytics-eu")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"reporting_*", "events"}, datasets)
+	})
+}
+
+func Test_filterDatasets(t *testing.T) {
+	datasets := []string{"reporting_daily", "reporting_hourly", "events", "raw"}
+	assert.Equal(t, []string{"reporting_daily", "reporting_hourly", "events"}, filterDatasets(datasets, []string{"reporting_*", "events"}))
+	assert.Nil(t, filterDatasets(datasets, []string{"missing"}))
+}
+
+func Test_parseLabelFilter(t *testing.T) {
+	filter, err := parseLabelFilter("labels.env:prod  labels.team")
+	require.NoError(t, err)
+	assert.True(t, filter.matches(map[string]string{"env": "prod", "team": "sales"}))
+	assert.False(t, filter.matches(map[string]string{"env": "dev", "team": "sales"}))
+	assert.False(t, filter.matches(map[string]string{"env": "prod"}))
+
+	filter, err = parseLabelFilter("")
+	require.NoError(t, err)
+	assert.True(t, filter.matches(nil))
+
+	_, err = parseLabelFilter("env:prod")
+	assert.ErrorContains(t, err, "invalid dataset label filter")
 }
 
 func Test_getApi(t *testing.T) {
@@ -2,7 +2,10 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	bq "cloud.google.com/go/bigquery"
@@ -10,32 +13,229 @@ import (
 )
 
 // BigQuery reports at most 50 referenced tables in query statistics; beyond
-// that the list is incomplete and dataset access cannot be verified.
+// that the list is incomplete and the tables are read from the SQL instead.
 const maxReportedReferencedTables = 50
 
 // Statement types for which dry-run statistics cannot be trusted to list every
 // referenced table (multi-statement scripts, dynamic SQL, procedure calls).
+// Static scripts are checked statement by statement by CheckAllowedQuery.
 var allowlistDeniedStatementTypes = map[string]bool{
 	"SCRIPT":            true,
 	"EXECUTE_IMMEDIATE": true,
 	"CALL":              true,
 }
 
+// Rules reported by DenialError
+const (
+	DenialMissingStatistics = "missing_statistics"
+	DenialStatementType     = "statement_type"
+	DenialTooManyTables     = "too_many_tables"
+	DenialInvalidRule       = "invalid_rule"
+	DenialDeniedTable       = "denied_table"
+	DenialNotAllowed        = "not_allowed"
+	DenialScript            = "script"
+)
+
+// DenialError is returned when the dataset restriction rejects a query
+type DenialError struct {
+	// Rule names the check that rejected the query
+	Rule string
+	// Table is the referenced table that was rejected, if any
+	Table string
+	// ReferencedTables are the tables referenced by the query, as far as
+	// they are known
+	ReferencedTables []string
+	err              error
+}
+
+func (e *DenialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DenialError) Unwrap() error {
+	return e.err
+}
+
+func tableNames(tables []*bq.Table) []string {
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		names = append(names, table.ProjectID+"."+table.DatasetID+"."+table.TableID)
+	}
+	return names
+}
+
+// AllowedDataset is an entry of the additional allowed datasets or denied
+// tables. Project is empty for bare "dataset" entries, which belong to the
+// default project, and Table is empty for entries covering a whole dataset.
+// Every part may be a glob pattern as understood by path.Match, for example
+// "analytics-*.reporting_*" or "public-data.*".
+type AllowedDataset struct {
+	Project string
+	Dataset string
+	Table   string
+}
+
+var (
+	allowedProjectPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-:.*?\[\]!^]+$`)
+	allowedDatasetPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-*?\[\]!^]+$`)
+	allowedTablePattern   = regexp.MustCompile(`^[^.\s]+$`)
+)
+
+// ParseAllowedDataset parses an additional allowed dataset entry:
+// "project.dataset.table", "project.dataset" or a bare "dataset". Domain-scoped
+// project IDs such as "example.com:project" contain a dot, so the project part
+// extends to the first dot after the colon.
+func ParseAllowedDataset(entry string) (AllowedDataset, error) {
+	var allowed AllowedDataset
+	start := max(strings.Index(entry, ":"), 0)
+	if i := strings.Index(entry[start:], "."); i >= 0 {
+		allowed.Project = entry[:start+i]
+		allowed.Dataset, allowed.Table, _ = strings.Cut(entry[start+i+1:], ".")
+		if !allowedProjectPattern.MatchString(allowed.Project) {
+			return AllowedDataset{}, fmt.Errorf("invalid dataset entry %q: the project %q must be a project ID or a pattern such as analytics-*", entry, allowed.Project)
+		}
+		if strings.Contains(entry[start+i+1:], ".") && !allowedTablePattern.MatchString(allowed.Table) {
+			return AllowedDataset{}, fmt.Errorf("invalid dataset entry %q: the table %q must be a table name or a pattern such as orders_*", entry, allowed.Table)
+		}
+	} else {
+		allowed.Dataset = entry
+	}
+	if !allowedDatasetPattern.MatchString(allowed.Dataset) {
+		return AllowedDataset{}, fmt.Errorf("invalid dataset entry %q: the dataset %q must be a dataset name or a pattern such as reporting_*", entry, allowed.Dataset)
+	}
+	for _, pattern := range []string{allowed.Project, allowed.Dataset, allowed.Table} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return AllowedDataset{}, fmt.Errorf("invalid dataset entry %q: malformed pattern %q", entry, pattern)
+		}
+	}
+	return allowed, nil
+}
+
+// ParseDeniedTable parses a denied table entry, which must be fully qualified
+// as "project.dataset.table" so it cannot be mistaken for a dataset entry.
+func ParseDeniedTable(entry string) (AllowedDataset, error) {
+	denied, err := ParseAllowedDataset(entry)
+	if err != nil {
+		return AllowedDataset{}, err
+	}
+	if denied.Project == "" || denied.Table == "" {
+		return AllowedDataset{}, fmt.Errorf("invalid denied table %q: use the project.dataset.table form", entry)
+	}
+	return denied, nil
+}
+
+// IsPattern reports whether a project or dataset entry contains wildcards
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// PatternRegexp returns an RE2 regular expression matching the names a glob
+// pattern of an entry matches, so entries can be matched in SQL with
+// REGEXP_CONTAINS. An empty pattern matches every name.
+func PatternRegexp(pattern string) (string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("malformed pattern %q", pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if pattern == "" {
+		expr.WriteString(".*")
+	}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			expr.WriteString("[")
+			if i++; runes[i] == '^' {
+				expr.WriteString("^/")
+				i++
+			}
+			for ; runes[i] != ']'; i++ {
+				// An unescaped - is always a range in path.Match patterns
+				if runes[i] == '-' {
+					expr.WriteString("-")
+					continue
+				}
+				if runes[i] == '\\' {
+					i++
+				}
+				if runes[i] < 0x80 && !isIdentifierChar(byte(runes[i])) {
+					expr.WriteString("\\")
+				}
+				expr.WriteRune(runes[i])
+			}
+			expr.WriteString("]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	expr.WriteString("$")
+
+	if _, err := regexp.Compile(expr.String()); err != nil {
+		return "", fmt.Errorf("malformed pattern %q", pattern)
+	}
+	return expr.String(), nil
+}
+
+// MatchesProject reports whether the entry's project matches project. Bare
+// entries never match; they are qualified with the default project by callers
+// that have one.
+func (a AllowedDataset) MatchesProject(project string) bool {
+	if a.Project == "" {
+		return false
+	}
+	matched, _ := path.Match(a.Project, project)
+	return matched
+}
+
+// MatchesDataset reports whether the entry's dataset matches dataset
+func (a AllowedDataset) MatchesDataset(dataset string) bool {
+	matched, _ := path.Match(a.Dataset, dataset)
+	return matched
+}
+
+// Matches reports whether the entry covers the table of dataset in project
+func (a AllowedDataset) Matches(project string, dataset string, table string) bool {
+	if !a.MatchesProject(project) || !a.MatchesDataset(dataset) {
+		return false
+	}
+	if a.Table == "" {
+		return true
+	}
+	matched, _ := path.Match(a.Table, table)
+	return matched
+}
+
 // CheckAllowedDatasets verifies that every table referenced by a query, as
-// reported by a dry run, either belongs to one of the accessible projects or
-// to one of the additionally allowed datasets. Dataset entries are either
-// "project.dataset" or a bare "dataset", which is qualified with
-// defaultProject. It fails closed when the referenced tables cannot be
-// reliably determined.
-func CheckAllowedDatasets(stats *bq.QueryStatistics, accessibleProjects []string, additionalDatasets []string, defaultProject string) error {
+// reported by a dry run, is not denied and either belongs to one of the
+// accessible projects or to one of the additionally allowed datasets. Dataset
+// entries are "project.dataset.table", "project.dataset" or a bare "dataset",
+// which is qualified with defaultProject, and may contain glob patterns (see
+// AllowedDataset). Denied tables take precedence over both. When the dry run
+// lists too many tables to be complete, the tables are read from query
+// instead. It fails closed when the referenced tables cannot be reliably
+// determined.
+func CheckAllowedDatasets(stats *bq.QueryStatistics, query string, accessibleProjects []string, additionalDatasets []string, deniedTables []string, defaultProject string) error {
 	if stats == nil {
-		return fmt.Errorf("could not determine the tables referenced by the query: this data source restricts which datasets can be queried")
+		return &DenialError{Rule: DenialMissingStatistics, err: fmt.Errorf("could not determine the tables referenced by the query: this data source restricts which datasets can be queried")}
 	}
 	if allowlistDeniedStatementTypes[stats.StatementType] {
-		return fmt.Errorf("multi-statement scripts, EXECUTE IMMEDIATE and procedure calls are not supported because this data source restricts which datasets can be queried; run each statement as a separate query")
+		return &DenialError{Rule: DenialStatementType, err: fmt.Errorf("multi-statement scripts, EXECUTE IMMEDIATE and procedure calls are not supported because this data source restricts which datasets can be queried; run each statement as a separate query")}
 	}
-	if len(stats.ReferencedTables) >= maxReportedReferencedTables {
-		return fmt.Errorf("the query references too many tables (%d or more) to verify dataset access for this data source; split it into smaller queries that each reference fewer tables", maxReportedReferencedTables)
+	referencedTables := stats.ReferencedTables
+	if len(referencedTables) >= maxReportedReferencedTables {
+		var err error
+		if referencedTables, err = completeReferencedTables(stats, query, defaultProject); err != nil {
+			return &DenialError{Rule: DenialTooManyTables, ReferencedTables: tableNames(stats.ReferencedTables), err: fmt.Errorf("the query references too many tables (%d or more) for the dry run to list them all, and they could not be read from the SQL to verify dataset access for this data source (%s); split it into smaller queries that each reference fewer tables", maxReportedReferencedTables, err)}
+		}
 	}
 
 	projects := make(map[string]bool, len(accessibleProjects))
@@ -43,58 +243,157 @@ func CheckAllowedDatasets(stats *bq.QueryStatistics, accessibleProjects []string
 		projects[project] = true
 	}
 
-	datasets := make(map[string]bool, len(additionalDatasets))
+	datasets := make([]AllowedDataset, 0, len(additionalDatasets))
 	// Bare entries need a default project to be qualified with; without one
 	// they can never match, so they are skipped and called out on denial.
 	var skippedBareEntries []string
 	for _, entry := range additionalDatasets {
-		if !strings.Contains(entry, ".") {
+		allowed, err := ParseAllowedDataset(entry)
+		if err != nil {
+			// Entries are validated when the settings are loaded; an invalid
+			// one never allows anything.
+			continue
+		}
+		if allowed.Project == "" {
 			if defaultProject == "" {
 				skippedBareEntries = append(skippedBareEntries, entry)
 				continue
 			}
-			entry = defaultProject + "." + entry
+			allowed.Project = defaultProject
+		}
+		datasets = append(datasets, allowed)
+	}
+
+	denied := make([]AllowedDataset, 0, len(deniedTables))
+	for _, entry := range deniedTables {
+		rule, err := ParseDeniedTable(entry)
+		if err != nil {
+			// Entries are validated when the settings are loaded; deny rules
+			// must not be weakened by a typo, so deny outright.
+			return &DenialError{Rule: DenialInvalidRule, ReferencedTables: tableNames(referencedTables), err: fmt.Errorf("the denied table entry %q is invalid: %w", entry, err)}
+		}
+		denied = append(denied, rule)
+	}
+
+	for _, table := range referencedTables {
+		if matchesAnyDataset(denied, table.ProjectID, table.DatasetID, table.TableID) || deniesWildcardTable(denied, table) {
+			name := table.ProjectID + "." + table.DatasetID + "." + table.TableID
+			return &DenialError{Rule: DenialDeniedTable, Table: name, ReferencedTables: tableNames(referencedTables), err: fmt.Errorf("the query references table %q, which is denied by this data source", name)}
 		}
-		datasets[entry] = true
 	}
 
-	for _, table := range stats.ReferencedTables {
-		if !projects[table.ProjectID] && !datasets[table.ProjectID+"."+table.DatasetID] {
-			err := fmt.Errorf("the query references table %q, which is outside the projects accessible to this data source and not in its additional allowed datasets", table.ProjectID+"."+table.DatasetID+"."+table.TableID)
+	for _, table := range referencedTables {
+		if !projects[table.ProjectID] && !matchesAnyDataset(datasets, table.ProjectID, table.DatasetID, table.TableID) {
+			name := table.ProjectID + "." + table.DatasetID + "." + table.TableID
+			err := fmt.Errorf("the query references table %q, which is outside the projects accessible to this data source and not in its additional allowed datasets", name)
 			if len(skippedBareEntries) > 0 {
 				err = fmt.Errorf("%s (the allowed dataset entries %q were ignored because the data source has no default project to qualify them with; use the project.dataset form)", err, strings.Join(skippedBareEntries, ", "))
 			}
-			return err
+			return &DenialError{Rule: DenialNotAllowed, Table: name, ReferencedTables: tableNames(referencedTables), err: err}
 		}
 	}
 	return nil
 }
 
-// enforceAllowedDatasets dry-runs the query and rejects it if it references
-// tables outside the projects accessible to the data source and the
-// additionally allowed datasets. It is a no-op when the restriction is not
-// enabled.
-func (c *Conn) enforceAllowedDatasets(ctx context.Context, query string) error {
-	if !c.cfg.RestrictToAccessibleDatasets {
+// deniesWildcardTable reports whether a wildcard table read from the SQL, such
+// as events_*, may cover a denied table. Any deny rule for its dataset counts.
+func deniesWildcardTable(denied []AllowedDataset, table *bq.Table) bool {
+	if !IsPattern(table.TableID) {
+		return false
+	}
+	for _, rule := range denied {
+		if rule.MatchesProject(table.ProjectID) && rule.MatchesDataset(table.DatasetID) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyDataset(datasets []AllowedDataset, project string, dataset string, table string) bool {
+	for _, allowed := range datasets {
+		if allowed.Matches(project, dataset, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceQueryRestrictions dry-runs the query and rejects it if read-only
+// mode does not allow its statement type, or if it references tables outside
+// the projects accessible to the data source and the additionally allowed
+// datasets. It is a no-op when neither restriction is enabled.
+func (c *Conn) enforceQueryRestrictions(ctx context.Context, query string) error {
+	if !c.cfg.ReadOnly && !c.cfg.RestrictToAccessibleDatasets {
 		return nil
 	}
 
-	q := c.client.Query(query)
-	q.DryRun = true
-	q.Location = c.client.Location
-	q.Labels = c.headersAsLabels(ctx)
+	// The statement type verdict is keyed on the exact query: queries that
+	// normalize alike may still lex differently and run other statements.
+	var keys []string
+	if c.cfg.ReadOnly {
+		keys = append(keys, statementTypeVerdictKey(query))
+	}
+	if c.cfg.RestrictToAccessibleDatasets {
+		keys = append(keys, datasetVerdictKey(query))
+	}
+	if c.cfg.AllowlistVerdicts != nil {
+		allowed := true
+		for _, key := range keys {
+			verdict, ok := c.cfg.AllowlistVerdicts.Get(key)
+			if ok && verdict != nil {
+				return c.reject(ctx, query, verdict)
+			}
+			allowed = allowed && ok
+		}
+		if allowed {
+			return nil
+		}
+	}
 
-	job, err := q.Run(ctx)
+	stats, err := c.dryRun(ctx, query)
 	if err != nil {
 		// The real run would fail with the same error; surface it directly.
 		return err
 	}
 
-	var stats *bq.QueryStatistics
-	if status := job.LastStatus(); status != nil && status.Statistics != nil {
-		stats, _ = status.Statistics.Details.(*bq.QueryStatistics)
+	if c.cfg.ReadOnly {
+		checkErr := CheckStatementType(stats, c.cfg.AllowedStatementTypes)
+		if c.cfg.AllowlistVerdicts != nil {
+			c.cfg.AllowlistVerdicts.Set(statementTypeVerdictKey(query), checkErr)
+		}
+		if checkErr != nil {
+			return c.reject(ctx, query, checkErr)
+		}
+	}
+	if c.cfg.RestrictToAccessibleDatasets {
+		checkErr, cacheable := c.checkAllowedDatasets(ctx, stats, query)
+		if c.cfg.AllowlistVerdicts != nil && cacheable {
+			c.cfg.AllowlistVerdicts.Set(datasetVerdictKey(query), checkErr)
+		}
+		if checkErr != nil {
+			return c.reject(ctx, query, checkErr)
+		}
 	}
+	return nil
+}
 
+// statementTypeVerdictKey returns the verdict cache key of the read-only
+// check of a query
+func statementTypeVerdictKey(query string) string {
+	return "statement:" + query
+}
+
+// datasetVerdictKey returns the verdict cache key of the dataset restriction
+// check of a query, shared by the queries that normalize alike
+func datasetVerdictKey(query string) string {
+	return "datasets:" + normalizeQuery(query)
+}
+
+// checkAllowedDatasets checks the tables referenced by a dry-run query
+// against the dataset restriction. A verdict reached without the accessible
+// projects is not cacheable, so the query is checked again once they can be
+// listed.
+func (c *Conn) checkAllowedDatasets(ctx context.Context, stats *bq.QueryStatistics, query string) (error, bool) {
 	// When project enumeration fails, fall back to checking against the
 	// additional allowed datasets alone; never fail open.
 	var accessibleProjects []string
@@ -103,12 +402,95 @@ func (c *Conn) enforceAllowedDatasets(ctx context.Context, query string) error {
 		accessibleProjects, projectsErr = c.cfg.AccessibleProjects(ctx)
 	}
 
-	checkErr := CheckAllowedDatasets(stats, accessibleProjects, c.cfg.AdditionalAllowedDatasets, c.cfg.Project)
+	checkErr := CheckAllowedQuery(ctx, stats, query, c.dryRun, func(stats *bq.QueryStatistics, query string) error {
+		return CheckAllowedDatasets(stats, query, accessibleProjects, c.cfg.AdditionalAllowedDatasets, c.cfg.DeniedTables, c.cfg.Project)
+	})
 	if checkErr != nil && projectsErr != nil {
-		checkErr = fmt.Errorf("%s (could not list accessible projects: %s)", checkErr, projectsErr)
+		checkErr = fmt.Errorf("%w (could not list accessible projects: %s)", checkErr, projectsErr)
 	}
-	if checkErr != nil {
-		return backend.DownstreamError(checkErr)
+	return checkErr, projectsErr == nil
+}
+
+// reject returns the error for a denied query, auditing dataset restriction
+// denials
+func (c *Conn) reject(ctx context.Context, query string, err error) error {
+	var statementTypeErr *StatementTypeError
+	if !errors.As(err, &statementTypeErr) {
+		c.auditDenial(ctx, query, err)
 	}
-	return nil
+	return backend.DownstreamError(err)
+}
+
+// normalizeQuery returns the query with comments removed, whitespace
+// collapsed and numbers and string literals replaced, so queries that only
+// differ in their time range share a cached verdict. Queries on wildcard
+// tables keep their literals, since a _TABLE_SUFFIX filter decides which
+// tables they reference. Any doubt about how BigQuery lexes the query, such
+// as an escape sequence in a literal or an unexpected character, keeps the
+// exact query, so differently lexed queries never share a verdict.
+func normalizeQuery(query string) string {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return query
+	}
+	for _, tok := range tokens {
+		if (tok.kind == sqlLiteral && strings.Contains(tok.text, "\\")) ||
+			(tok.kind == sqlPunctuation && !strings.Contains(normalizedPunctuation, tok.text)) {
+			return query
+		}
+	}
+
+	wildcard := false
+	for _, tok := range tokens {
+		if (tok.kind == sqlIdentifier || tok.kind == sqlQuotedIdentifier) && strings.HasSuffix(tok.text, "*") {
+			wildcard = true
+			break
+		}
+	}
+
+	parts := make([]string, len(tokens))
+	for i, tok := range tokens {
+		parts[i] = query[tok.start:tok.end]
+		if wildcard {
+			continue
+		}
+		nextToDot := (i > 0 && tokens[i-1].is(".")) || (i+1 < len(tokens) && tokens[i+1].is("."))
+		if tok.kind == sqlLiteral || (tok.kind == sqlIdentifier && isNumber(tok.text) && !nextToDot) {
+			parts[i] = "?"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizedPunctuation are the punctuation characters normalizeQuery knows
+// how BigQuery lexes
+const normalizedPunctuation = "(),.;=<>!+-*/%&|^~[]{}:@?"
+
+func isNumber(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] < '0' || text[i] > '9' {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// dryRun dry-runs the query and returns its statistics, or nil statistics
+// when BigQuery reports none
+func (c *Conn) dryRun(ctx context.Context, query string) (*bq.QueryStatistics, error) {
+	q := c.client.Query(query)
+	q.DryRun = true
+	q.Location = c.client.Location
+	q.Labels = c.headersAsLabels(ctx)
+
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats *bq.QueryStatistics
+	if status := job.LastStatus(); status != nil && status.Statistics != nil {
+		stats, _ = status.Statistics.Details.(*bq.QueryStatistics)
+	}
+	return stats, nil
 }
@@ -1,9 +1,15 @@
 package driver
 
 import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
 	"testing"
 
 	bq "cloud.google.com/go/bigquery"
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,8 +17,10 @@ func TestCheckAllowedDatasets(t *testing.T) {
 	tests := []struct {
 		name               string
 		stats              *bq.QueryStatistics
+		query              string
 		accessibleProjects []string
 		additionalDatasets []string
+		deniedTables       []string
 		defaultProject     string
 		wantErr            string
 	}{
@@ -186,6 +194,111 @@ func TestCheckAllowedDatasets(t *testing.T) {
 			defaultProject:     "myproject",
 			wantErr:            `"myproject.mydataset.orders"`,
 		},
+		{
+			name: "tables matching project and dataset patterns are allowed",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "analytics-eu", DatasetID: "reporting_daily", TableID: "visits"},
+					{ProjectID: "public-data", DatasetID: "weather", TableID: "stations"},
+					{ProjectID: "myproject", DatasetID: "events_2024", TableID: "clicks"},
+				},
+			},
+			accessibleProjects: nil,
+			additionalDatasets: []string{"analytics-*.reporting_*", "public-data.*", "events_*"},
+			defaultProject:     "myproject",
+		},
+		{
+			name: "table outside the patterns is rejected",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "analytics-eu", DatasetID: "raw", TableID: "visits"},
+				},
+			},
+			accessibleProjects: nil,
+			additionalDatasets: []string{"analytics-*.reporting_*"},
+			defaultProject:     "myproject",
+			wantErr:            `"analytics-eu.raw.visits"`,
+		},
+		{
+			name: "invalid entries never allow anything",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "other-project", DatasetID: "sales[", TableID: "orders"},
+				},
+			},
+			accessibleProjects: nil,
+			additionalDatasets: []string{"other-project.sales["},
+			defaultProject:     "myproject",
+			wantErr:            `"other-project.sales[.orders"`,
+		},
+		{
+			name: "table entries only allow the listed tables",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "shared", DatasetID: "crm", TableID: "accounts"},
+					{ProjectID: "shared", DatasetID: "crm", TableID: "contacts"},
+				},
+			},
+			accessibleProjects: []string{"myproject"},
+			additionalDatasets: []string{"shared.crm.accounts"},
+			defaultProject:     "myproject",
+			wantErr:            `"shared.crm.contacts"`,
+		},
+		{
+			name: "table patterns are allowed",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "shared", DatasetID: "crm", TableID: "report_daily"},
+				},
+			},
+			additionalDatasets: []string{"shared.crm.report_*"},
+			defaultProject:     "myproject",
+		},
+		{
+			name: "denied table in an accessible project is rejected",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "myproject", DatasetID: "crm", TableID: "accounts"},
+					{ProjectID: "myproject", DatasetID: "crm", TableID: "pii_contacts"},
+				},
+			},
+			accessibleProjects: []string{"myproject"},
+			deniedTables:       []string{"myproject.crm.pii_*"},
+			defaultProject:     "myproject",
+			wantErr:            `"myproject.crm.pii_contacts", which is denied`,
+		},
+		{
+			name: "deny takes precedence over allowed datasets",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "shared", DatasetID: "crm", TableID: "contacts"},
+				},
+			},
+			additionalDatasets: []string{"shared.crm"},
+			deniedTables:       []string{"shared.crm.contacts"},
+			defaultProject:     "myproject",
+			wantErr:            "which is denied",
+		},
+		{
+			name: "invalid denied table fails closed",
+			stats: &bq.QueryStatistics{
+				StatementType: "SELECT",
+				ReferencedTables: []*bq.Table{
+					{ProjectID: "myproject", DatasetID: "crm", TableID: "accounts"},
+				},
+			},
+			accessibleProjects: []string{"myproject"},
+			deniedTables:       []string{"crm.contacts"},
+			defaultProject:     "myproject",
+			wantErr:            `the denied table entry "crm.contacts" is invalid`,
+		},
 		{
 			name: "too many referenced tables fail closed",
 			stats: &bq.QueryStatistics{
@@ -196,11 +309,66 @@ func TestCheckAllowedDatasets(t *testing.T) {
 			defaultProject:     "myproject",
 			wantErr:            "references too many tables",
 		},
+		{
+			name: "too many referenced tables are read from the SQL",
+			stats: &bq.QueryStatistics{
+				StatementType:    "SELECT",
+				ReferencedTables: makeRegionTables(50),
+			},
+			query:              makeRegionUnion(70),
+			additionalDatasets: []string{"rollup-*.metrics"},
+			defaultProject:     "myproject",
+		},
+		{
+			name: "tables read from the SQL are checked",
+			stats: &bq.QueryStatistics{
+				StatementType:    "SELECT",
+				ReferencedTables: makeRegionTables(50),
+			},
+			query:              makeRegionUnion(70) + " UNION ALL SELECT * FROM `other.secret.daily`",
+			additionalDatasets: []string{"rollup-*.metrics"},
+			defaultProject:     "myproject",
+			wantErr:            `"other.secret.daily"`,
+		},
+		{
+			name: "tables read from the SQL must include the reported tables",
+			stats: &bq.QueryStatistics{
+				StatementType:    "SELECT",
+				ReferencedTables: append(makeRegionTables(49), &bq.Table{ProjectID: "rollup-0", DatasetID: "metrics", TableID: "view_source"}),
+			},
+			query:              makeRegionUnion(70),
+			additionalDatasets: []string{"rollup-*.metrics"},
+			defaultProject:     "myproject",
+			wantErr:            `"rollup-0.metrics.view_source" is referenced but was not found in the SQL`,
+		},
+		{
+			name: "wildcard tables read from the SQL are denied by rules in their dataset",
+			stats: &bq.QueryStatistics{
+				StatementType:    "SELECT",
+				ReferencedTables: makeRegionTables(50),
+			},
+			query:              makeRegionUnion(70) + " UNION ALL SELECT * FROM `rollup-0.metrics.*`",
+			additionalDatasets: []string{"rollup-*.metrics"},
+			deniedTables:       []string{"rollup-0.metrics.pii"},
+			defaultProject:     "myproject",
+			wantErr:            `"rollup-0.metrics.*", which is denied`,
+		},
+		{
+			name: "too many referenced tables in a script fail closed",
+			stats: &bq.QueryStatistics{
+				StatementType:    "CREATE_TABLE_AS_SELECT",
+				ReferencedTables: makeRegionTables(50),
+			},
+			query:              "CREATE TABLE myproject.tmp.rollup AS " + makeRegionUnion(70),
+			additionalDatasets: []string{"rollup-*.metrics"},
+			defaultProject:     "myproject",
+			wantErr:            "only SELECT statements are supported",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CheckAllowedDatasets(tt.stats, tt.accessibleProjects, tt.additionalDatasets, tt.defaultProject)
+			err := CheckAllowedDatasets(tt.stats, tt.query, tt.accessibleProjects, tt.additionalDatasets, tt.deniedTables, tt.defaultProject)
 			if tt.wantErr == "" {
 				assert.NoError(t, err)
 			} else {
@@ -210,6 +378,50 @@ func TestCheckAllowedDatasets(t *testing.T) {
 	}
 }
 
+func TestParseAllowedDataset(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    AllowedDataset
+		wantErr string
+	}{
+		{entry: "sales", want: AllowedDataset{Dataset: "sales"}},
+		{entry: "other-project.analytics", want: AllowedDataset{Project: "other-project", Dataset: "analytics"}},
+		{entry: "analytics-*.reporting_*", want: AllowedDataset{Project: "analytics-*", Dataset: "reporting_*"}},
+		{entry: "example.com:project.sales", want: AllowedDataset{Project: "example.com:project", Dataset: "sales"}},
+		{entry: "shared.crm.accounts", want: AllowedDataset{Project: "shared", Dataset: "crm", Table: "accounts"}},
+		{entry: "example.com:project.crm.report_*", want: AllowedDataset{Project: "example.com:project", Dataset: "crm", Table: "report_*"}},
+		{entry: "shared.crm.", wantErr: `the table "" must be a table name or a pattern`},
+		{entry: "shared.crm.accounts.extra", wantErr: `the table "accounts.extra" must be a table name or a pattern`},
+		{entry: "other-project.", wantErr: `the dataset "" must be a dataset name or a pattern`},
+		{entry: "other-project.my dataset", wantErr: `the dataset "my dataset" must be a dataset name or a pattern`},
+		{entry: "my project.sales", wantErr: `the project "my project" must be a project ID or a pattern`},
+		{entry: "[a-.sales", wantErr: `malformed pattern "[a-"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseAllowedDataset(tt.entry)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDeniedTable(t *testing.T) {
+	denied, err := ParseDeniedTable("shared.crm.pii_*")
+	assert.NoError(t, err)
+	assert.Equal(t, AllowedDataset{Project: "shared", Dataset: "crm", Table: "pii_*"}, denied)
+
+	_, err = ParseDeniedTable("shared.crm")
+	assert.ErrorContains(t, err, "use the project.dataset.table form")
+	_, err = ParseDeniedTable("contacts")
+	assert.ErrorContains(t, err, "use the project.dataset.table form")
+}
+
 func makeReferencedTables(n int) []*bq.Table {
 	tables := make([]*bq.Table, n)
 	for i := range tables {
@@ -217,3 +429,88 @@ func makeReferencedTables(n int) []*bq.Table {
 	}
 	return tables
 }
+
+// makeRegionTables returns the per-region rollup tables as reported by a dry
+// run of makeRegionUnion
+func makeRegionTables(n int) []*bq.Table {
+	tables := make([]*bq.Table, n)
+	for i := range tables {
+		tables[i] = &bq.Table{ProjectID: fmt.Sprintf("rollup-%d", i), DatasetID: "metrics", TableID: "daily"}
+	}
+	return tables
+}
+
+// makeRegionUnion returns a query combining the rollup tables of n regions
+func makeRegionUnion(n int) string {
+	selects := make([]string, n)
+	for i := range selects {
+		selects[i] = fmt.Sprintf("SELECT region, SUM(requests) AS requests FROM `rollup-%d.metrics.daily` GROUP BY region", i)
+	}
+	return strings.Join(selects, " UNION ALL ")
+}
+
+func TestPatternRegexp(t *testing.T) {
+	names := []string{"", "orders", "orders_2024", "Orders", "a.b", "a+b", "b-c", "x]", "pii_", "événements", "ab", "*"}
+	for _, pattern := range []string{"", "orders", "orders_*", "?rders*", "[a-c]*", "[^a-c]*", "[!a]b", "a.b", "a+b", `\*`, `[\]]`, "[é]*", "*_", `b[\-]c`} {
+		expr, err := PatternRegexp(pattern)
+		if !assert.NoError(t, err, pattern) {
+			continue
+		}
+		re := regexp.MustCompile(expr)
+		for _, name := range names {
+			matched, _ := path.Match(pattern, name)
+			if pattern == "" {
+				matched = true
+			}
+			assert.Equal(t, matched, re.MatchString(name), "%q matching %q", pattern, name)
+		}
+	}
+
+	_, err := PatternRegexp("orders_[")
+	assert.ErrorContains(t, err, "malformed pattern")
+}
+
+func Test_normalizeQuery(t *testing.T) {
+	assert.Equal(t,
+		"SELECT * FROM `myproject.sales.orders` WHERE ts > TIMESTAMP_MILLIS ( ? ) AND region = ? LIMIT ?",
+		normalizeQuery("SELECT *\n  FROM `myproject.sales.orders` -- orders\n  WHERE ts > TIMESTAMP_MILLIS(1700000000000) AND region = 'eu' LIMIT 10"),
+	)
+	assert.Equal(t, normalizeQuery("SELECT 1 FROM t WHERE a = 'x'"), normalizeQuery("SELECT   2 FROM t WHERE a = \"y\""))
+	// Dataset names may be numbers
+	assert.Equal(t, "SELECT ? FROM p . 2024 . t", normalizeQuery("SELECT 1 FROM p.2024.t"))
+	// _TABLE_SUFFIX filters decide which wildcard tables are referenced
+	assert.Equal(t, "SELECT * FROM `p.logs.events_*` WHERE _TABLE_SUFFIX > '2024'", normalizeQuery("SELECT * FROM `p.logs.events_*` WHERE _TABLE_SUFFIX > '2024'"))
+	// A backslash escapes the quote even in raw strings, so the second query
+	// reads secret.ds.t and must not share the verdict of the first
+	harmless, smuggled := "SELECT 'a', 'b' x FROM ok.ds.t", `SELECT r'\', ' FROM secret.ds.t --' x FROM ok.ds.t`
+	assert.NotEqual(t, normalizeQuery(harmless), normalizeQuery(smuggled))
+	assert.Equal(t, smuggled, normalizeQuery(smuggled))
+	refs, err := tableReferencesFromSQL(smuggled, "")
+	assert.NoError(t, err)
+	assert.Contains(t, refs, &bq.Table{ProjectID: "secret", DatasetID: "ds", TableID: "t"})
+	// Unexpected characters keep the exact query
+	assert.Equal(t, "SELECT 1 FROM t WHERE a = 'x' § 2", normalizeQuery("SELECT 1 FROM t WHERE a = 'x' § 2"))
+}
+
+type fakeVerdictCache map[string]error
+
+func (f fakeVerdictCache) Get(query string) (error, bool) {
+	verdict, ok := f[query]
+	return verdict, ok
+}
+
+func (f fakeVerdictCache) Set(query string, verdict error) {
+	f[query] = verdict
+}
+
+func TestEnforceQueryRestrictionsUsesCachedVerdicts(t *testing.T) {
+	cache := fakeVerdictCache{
+		datasetVerdictKey("SELECT * FROM sales.orders WHERE day > '2024-01-01'"): nil,
+		datasetVerdictKey("SELECT * FROM secret.data"):                           errors.New("denied"),
+	}
+	// Without a client, any dry run would panic
+	c := &Conn{cfg: &types.ConnectionSettings{RestrictToAccessibleDatasets: true, AllowlistVerdicts: cache}}
+
+	assert.NoError(t, c.enforceQueryRestrictions(t.Context(), "SELECT * FROM sales.orders WHERE day > '2024-02-01'"))
+	assert.ErrorContains(t, c.enforceQueryRestrictions(t.Context(), "SELECT * FROM secret.data"), "denied")
+}
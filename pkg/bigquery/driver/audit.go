@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// datasetRestrictionDenials counts the queries rejected by the dataset
+// restriction, by the rule that rejected them
+var datasetRestrictionDenials = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "grafana_plugin",
+	Name:      "bigquery_dataset_restriction_denials_total",
+	Help:      "Number of queries rejected by the dataset restriction",
+}, []string{"rule"})
+
+// auditDenial records a query rejected by the dataset restriction as a
+// structured log entry, so attempted access can be reviewed, and counts it in
+// datasetRestrictionDenials. The query is logged normalized, without its
+// literal values.
+func (c *Conn) auditDenial(ctx context.Context, query string, err error) {
+	rule := "unknown"
+	var deniedTable string
+	var referencedTables []string
+	var denial *DenialError
+	if errors.As(err, &denial) {
+		rule, deniedTable, referencedTables = denial.Rule, denial.Table, denial.ReferencedTables
+	}
+	datasetRestrictionDenials.WithLabelValues(rule).Inc()
+
+	args := []any{
+		"event", "dataset_restriction_denied",
+		"rule", rule,
+		"deniedTable", deniedTable,
+		"referencedTables", referencedTables,
+		"project", c.cfg.Project,
+		"location", c.cfg.Location,
+		"query", normalizeQuery(query),
+		"reason", err.Error(),
+	}
+	pluginContext := backend.PluginConfigFromContext(ctx)
+	if pluginContext.DataSourceInstanceSettings != nil {
+		args = append(args, "datasourceUID", pluginContext.DataSourceInstanceSettings.UID)
+	}
+	if pluginContext.User != nil {
+		args = append(args, "user", pluginContext.User.Login)
+	}
+	// Dashboard, panel and query group, as attached to BigQuery jobs
+	labels := c.headersAsLabels(ctx)
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		args = append(args, key, labels[key])
+	}
+
+	log.DefaultLogger.FromContext(ctx).Warn("Query denied by dataset restriction", args...)
+}
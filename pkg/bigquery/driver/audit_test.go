@@ -0,0 +1,64 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+)
+
+func denialCount(t *testing.T, rule string) float64 {
+	var metric dto.Metric
+	require.NoError(t, datasetRestrictionDenials.WithLabelValues(rule).Write(&metric))
+	return metric.GetCounter().GetValue()
+}
+
+func TestCheckAllowedDatasetsDenialRules(t *testing.T) {
+	tables := []*bq.Table{
+		{ProjectID: "myproject", DatasetID: "sales", TableID: "orders"},
+		{ProjectID: "shared", DatasetID: "crm", TableID: "contacts"},
+	}
+	stats := &bq.QueryStatistics{StatementType: "SELECT", ReferencedTables: tables}
+
+	var denial *DenialError
+	err := CheckAllowedDatasets(stats, "", []string{"myproject"}, nil, nil, "myproject")
+	require.ErrorAs(t, err, &denial)
+	assert.Equal(t, DenialNotAllowed, denial.Rule)
+	assert.Equal(t, "shared.crm.contacts", denial.Table)
+	assert.Equal(t, []string{"myproject.sales.orders", "shared.crm.contacts"}, denial.ReferencedTables)
+
+	err = CheckAllowedDatasets(stats, "", []string{"myproject", "shared"}, nil, []string{"shared.crm.*"}, "myproject")
+	require.ErrorAs(t, err, &denial)
+	assert.Equal(t, DenialDeniedTable, denial.Rule)
+	assert.Equal(t, "shared.crm.contacts", denial.Table)
+
+	err = CheckAllowedDatasets(&bq.QueryStatistics{StatementType: "CALL"}, "", nil, nil, nil, "myproject")
+	require.ErrorAs(t, err, &denial)
+	assert.Equal(t, DenialStatementType, denial.Rule)
+
+	// The error can be wrapped, as with the accessible projects error
+	err = CheckAllowedDatasets(nil, "", nil, nil, nil, "myproject")
+	require.ErrorAs(t, fmt.Errorf("%w (could not list accessible projects)", err), &denial)
+	assert.Equal(t, DenialMissingStatistics, denial.Rule)
+}
+
+func TestAuditDenial(t *testing.T) {
+	c := &Conn{cfg: &types.ConnectionSettings{
+		Project: "myproject",
+		Headers: map[string][]string{HeaderDashboardUID: {"dashboard-1"}, HeaderPanelID: {"4"}},
+	}}
+
+	before := denialCount(t, DenialDeniedTable)
+	c.auditDenial(t.Context(), "SELECT * FROM shared.crm.contacts WHERE id = 'x'", &DenialError{Rule: DenialDeniedTable, Table: "shared.crm.contacts", err: errors.New("denied")})
+	assert.Equal(t, before+1, denialCount(t, DenialDeniedTable))
+
+	before = denialCount(t, "unknown")
+	c.auditDenial(t.Context(), "SELECT 1", errors.New("denied"))
+	assert.Equal(t, before+1, denialCount(t, "unknown"))
+}
@@ -0,0 +1,132 @@
+package driver
+
+import (
+	"database/sql/driver"
+	b64 "encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// columnType describes how the driver handles a BigQuery column type: the Go
+// type rows report as its scan type and how its values are converted to
+// driver values. Both are defined here so they cannot drift apart.
+type columnType struct {
+	scanType reflect.Type
+	// convert converts a non-null, non-repeated value. RECORD values are
+	// converted by ConvertRecordValue instead.
+	convert func(v bigquery.Value) (driver.Value, error)
+}
+
+var (
+	int64ScanType   = reflect.TypeOf(int64(0))
+	float64ScanType = reflect.TypeOf(float64(0))
+	stringScanType  = reflect.TypeOf("")
+	boolScanType    = reflect.TypeOf(false)
+	timeScanType    = reflect.TypeOf(time.Time{})
+	jsonScanType    = reflect.TypeOf(json.RawMessage{})
+)
+
+var (
+	integerColumnType = columnType{int64ScanType, func(v bigquery.Value) (driver.Value, error) {
+		// Ref https://github.com/googleapis/google-cloud-go/blob/1063c601a4c4a99217b45be0b25caa460e7157a1/datastore/load.go#L266
+		return v.(int64), nil
+	}}
+	floatColumnType = columnType{float64ScanType, func(v bigquery.Value) (driver.Value, error) {
+		return v.(float64), nil
+	}}
+	numericColumnType = columnType{float64ScanType, func(v bigquery.Value) (driver.Value, error) {
+		conv, _ := v.(*big.Rat).Float64()
+		return conv, nil
+	}}
+	boolColumnType = columnType{boolScanType, func(v bigquery.Value) (driver.Value, error) {
+		return v.(bool), nil
+	}}
+	stringColumnType = columnType{stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		return v.(string), nil
+	}}
+)
+
+// columnTypes maps BigQuery column types, including their legacy SQL and
+// alias names, to how the driver handles them.
+var columnTypes = map[string]columnType{
+	"TINYINT":    integerColumnType,
+	"SMALLINT":   integerColumnType,
+	"INT":        integerColumnType,
+	"INTEGER":    integerColumnType,
+	"INT64":      integerColumnType,
+	"BIGINT":     integerColumnType,
+	"BYTEINT":    integerColumnType,
+	"FLOAT":      floatColumnType,
+	"FLOAT64":    floatColumnType,
+	"NUMERIC":    numericColumnType,
+	"DECIMAL":    numericColumnType,
+	"BIGNUMERIC": numericColumnType,
+	"BIGDECIMAL": numericColumnType,
+	"BOOLEAN":    boolColumnType,
+	"BOOL":       boolColumnType,
+	"STRING":     stringColumnType,
+	// GEOGRAPHY values are returned as WKT strings from BigQuery
+	"GEOGRAPHY": stringColumnType,
+	"BYTES": {stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		return b64.StdEncoding.EncodeToString(v.([]byte)), nil
+	}},
+	"TIME": {stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		return bigquery.CivilTimeString(v.(civil.Time)), nil
+	}},
+	"DATE": {stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		res := v.(civil.Date)
+		if !res.IsValid() {
+			return nil, nil
+		}
+		return res.String(), nil
+	}},
+	"DATETIME": {stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		return bigquery.CivilDateTimeString(v.(civil.DateTime)), nil
+	}},
+	"TIMESTAMP": {timeScanType, func(v bigquery.Value) (driver.Value, error) {
+		// TIMESTAMP values come as time.Time from BigQuery
+		return v.(time.Time), nil
+	}},
+	"JSON": {jsonScanType, func(v bigquery.Value) (driver.Value, error) {
+		// JSON values are returned as strings from BigQuery
+		return v.(string), nil
+	}},
+	"INTERVAL": {float64ScanType, func(v bigquery.Value) (driver.Value, error) {
+		// INTERVAL values are returned as *bigquery.IntervalValue from BigQuery
+		return IntervalSeconds(v.(*bigquery.IntervalValue)), nil
+	}},
+	"RANGE": {stringScanType, func(v bigquery.Value) (driver.Value, error) {
+		// RANGE values are returned as *bigquery.RangeValue from BigQuery
+		rangeValue := v.(*bigquery.RangeValue)
+		// Convert RangeValue to string representation like "[start,end)"
+		startStr := "unbounded"
+		endStr := "unbounded"
+
+		if rangeValue.Start != nil {
+			startStr = fmt.Sprintf("%v", rangeValue.Start)
+		}
+		if rangeValue.End != nil {
+			endStr = fmt.Sprintf("%v", rangeValue.End)
+		}
+
+		return fmt.Sprintf("[%s,%s)", startStr, endStr), nil
+	}},
+	// RECORD values are marshalled to JSON strings by rows
+	"RECORD": {scanType: stringScanType},
+	"STRUCT": {scanType: stringScanType},
+}
+
+// defaultPrecisionScale holds the precision and scale of unparameterized
+// NUMERIC and BIGNUMERIC columns
+var defaultPrecisionScale = map[string][2]int64{
+	"NUMERIC":    {38, 9},
+	"DECIMAL":    {38, 9},
+	"BIGNUMERIC": {76, 38},
+	"BIGDECIMAL": {76, 38},
+}
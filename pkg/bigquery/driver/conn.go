@@ -125,7 +125,7 @@ func (c *Conn) execContext(ctx context.Context, query string, args []driver.Valu
 		return nil, err
 	}
 
-	if err = c.enforceAllowedDatasets(ctx, query); err != nil {
+	if err = c.enforceQueryRestrictions(ctx, query); err != nil {
 		return nil, err
 	}
 
@@ -257,7 +257,7 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 }
 
 func (c *Conn) queryContext(ctx context.Context, query string) (driver.Rows, error) {
-	if err := c.enforceAllowedDatasets(ctx, query); err != nil {
+	if err := c.enforceQueryRestrictions(ctx, query); err != nil {
 		return nil, err
 	}
 
@@ -289,7 +289,9 @@ func (c *Conn) queryContext(ctx context.Context, query string) (driver.Rows, err
 	log.DefaultLogger.Debug("Executed query", "usingStorageAPI", rowsIterator.IsAccelerated())
 
 	res := &rows{
-		rs: resultSet{},
+		rs:                   resultSet{},
+		geographyAsGeoJSON:   c.cfg.GeographyAsGeoJSON,
+		unitsFromColumnNames: c.cfg.UnitsFromColumnNames,
 	}
 	for {
 		var row []bq.Value
@@ -309,6 +311,22 @@ func (c *Conn) queryContext(ctx context.Context, query string) (driver.Rows, err
 		res.types = append(res.types, fmt.Sprintf("%v", column.Type))
 	}
 
+	if err := res.splitRangeColumns(); err != nil {
+		return nil, err
+	}
+
+	if c.cfg.GeographyAsGeoJSON {
+		res.appendPointCoordinates()
+	}
+
+	if c.cfg.ExtractJSONKeys {
+		res.extractJSONKeys()
+	}
+
+	if fieldConfigs := FieldConfigsFromContext(ctx); fieldConfigs != nil {
+		fieldConfigs.set(query, res.fieldConfigs())
+	}
+
 	return res, nil
 }
 
@@ -0,0 +1,144 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type fieldConfigsKey struct{}
+
+// FieldConfigs collects the field config derived from the BigQuery schema of
+// query results. The data frames sqlds builds from the rows carry no schema
+// information, so the datasource attaches a collector to the request context
+// and applies it to the frames once the queries have run. Configs are keyed by
+// the executed query, which sqlds records in the frame metadata.
+type FieldConfigs struct {
+	mu      sync.Mutex
+	queries map[string]map[string]*data.FieldConfig
+}
+
+// WithFieldConfigs returns a context that collects the field config of the
+// queries run with it.
+func WithFieldConfigs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldConfigsKey{}, &FieldConfigs{queries: make(map[string]map[string]*data.FieldConfig)})
+}
+
+// FieldConfigsFromContext returns the collector attached to the context, or nil
+func FieldConfigsFromContext(ctx context.Context) *FieldConfigs {
+	configs, _ := ctx.Value(fieldConfigsKey{}).(*FieldConfigs)
+	return configs
+}
+
+func (f *FieldConfigs) set(query string, configs map[string]*data.FieldConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries[query] = configs
+}
+
+// Apply sets the collected field config on the fields of frames built from a
+// collected query. Config already set on a field is kept.
+func (f *FieldConfigs) Apply(frames data.Frames) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, frame := range frames {
+		if frame == nil || frame.Meta == nil {
+			continue
+		}
+		configs := f.queries[frame.Meta.ExecutedQueryString]
+		for _, field := range frame.Fields {
+			if config, ok := configs[field.Name]; ok && field.Config == nil {
+				copied := *config
+				field.Config = &copied
+			}
+		}
+	}
+}
+
+// unitTag matches a unit declared in a column description, such as "[unit: ms]"
+var unitTag = regexp.MustCompile(`(?i)\s*\[unit:\s*([^\]]*?)\s*\]`)
+
+// columnNameUnits maps column name suffixes to Grafana units
+var columnNameUnits = []struct {
+	suffix string
+	unit   string
+}{
+	{"_ns", "ns"},
+	{"_us", "µs"},
+	{"_ms", "ms"},
+	{"_seconds", "s"},
+	{"_secs", "s"},
+	{"_minutes", "m"},
+	{"_mins", "m"},
+	{"_hours", "h"},
+	{"_days", "d"},
+	{"_bytes", "bytes"},
+	{"_bits", "bits"},
+	{"_percent", "percent"},
+	{"_pct", "percent"},
+	{"_usd", "currencyUSD"},
+	{"_eur", "currencyEUR"},
+	{"_gbp", "currencyGBP"},
+}
+
+var numericFieldTypes = map[bigquery.FieldType]bool{
+	bigquery.IntegerFieldType:    true,
+	"INT64":                      true,
+	bigquery.FloatFieldType:      true,
+	"FLOAT64":                    true,
+	bigquery.NumericFieldType:    true,
+	bigquery.BigNumericFieldType: true,
+}
+
+// fieldConfigFromSchema derives the field config of a column from its
+// BigQuery schema: the column description, a unit and a marker for columns
+// protected by policy tags. The unit comes from a "[unit: ...]" tag in the
+// description, which is removed from the displayed description, then from the
+// column type, and finally from the column name suffix when
+// unitsFromColumnNames is set. Returns nil when there is nothing to set.
+func fieldConfigFromSchema(schema *bigquery.FieldSchema, unitsFromColumnNames bool) *data.FieldConfig {
+	config := &data.FieldConfig{}
+
+	description := schema.Description
+	if match := unitTag.FindStringSubmatch(description); match != nil {
+		config.Unit = match[1]
+		description = strings.TrimSpace(unitTag.ReplaceAllString(description, ""))
+	}
+
+	if config.Unit == "" && schema.Type == bigquery.IntervalFieldType {
+		config.Unit = "s"
+	}
+	if config.Unit == "" && unitsFromColumnNames && numericFieldTypes[schema.Type] && !schema.Repeated {
+		name := strings.ToLower(schema.Name)
+		for _, u := range columnNameUnits {
+			if strings.HasSuffix(name, u.suffix) {
+				config.Unit = u.unit
+				break
+			}
+		}
+	}
+
+	if schema.PolicyTags != nil && len(schema.PolicyTags.Names) > 0 {
+		// Policy tags are resource names; the data catalog shows them by
+		// display name, which the schema does not carry.
+		note := fmt.Sprintf("Protected by column-level security (policy tags: %s). Values may be masked.", strings.Join(schema.PolicyTags.Names, ", "))
+		if description == "" {
+			description = note
+		} else {
+			description += "\n\n" + note
+		}
+		config.Custom = map[string]interface{}{"policyTags": schema.PolicyTags.Names}
+	}
+
+	config.Description = description
+	if config.Description == "" && config.Unit == "" && config.Custom == nil {
+		return nil
+	}
+	return config
+}
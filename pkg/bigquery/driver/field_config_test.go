@@ -0,0 +1,109 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldConfigs(t *testing.T) {
+	assert.Nil(t, FieldConfigsFromContext(context.Background()))
+
+	fieldConfigs := FieldConfigsFromContext(WithFieldConfigs(context.Background()))
+	require.NotNil(t, fieldConfigs)
+	fieldConfigs.set("SELECT duration FROM shifts", map[string]*data.FieldConfig{"duration": {Unit: "s"}})
+
+	newFrame := func(query string) *data.Frame {
+		frame := data.NewFrame("A",
+			data.NewField("duration", nil, []float64{60}),
+			data.NewField("name", nil, []string{"alice"}),
+		)
+		frame.Meta = &data.FrameMeta{ExecutedQueryString: query}
+		return frame
+	}
+
+	collected := newFrame("SELECT duration FROM shifts")
+	other := newFrame("SELECT duration FROM other")
+	configured := newFrame("SELECT duration FROM shifts")
+	configured.Fields[0].Config = &data.FieldConfig{Unit: "m"}
+
+	fieldConfigs.Apply(data.Frames{collected, other, configured, data.NewFrame("B")})
+
+	assert.Equal(t, &data.FieldConfig{Unit: "s"}, collected.Fields[0].Config)
+	assert.Nil(t, collected.Fields[1].Config)
+	assert.Nil(t, other.Fields[0].Config)
+	assert.Equal(t, &data.FieldConfig{Unit: "m"}, configured.Fields[0].Config)
+}
+
+func Test_fieldConfigFromSchema(t *testing.T) {
+	tests := []struct {
+		name                 string
+		schema               *bigquery.FieldSchema
+		unitsFromColumnNames bool
+		expected             *data.FieldConfig
+	}{
+		{
+			name:     "no description, unit or policy tags",
+			schema:   &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType},
+			expected: nil,
+		},
+		{
+			name:     "description",
+			schema:   &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType, Description: "Customer name"},
+			expected: &data.FieldConfig{Description: "Customer name"},
+		},
+		{
+			name:     "unit tag in description",
+			schema:   &bigquery.FieldSchema{Name: "latency", Type: bigquery.FloatFieldType, Description: "Request latency [unit: ms]"},
+			expected: &data.FieldConfig{Description: "Request latency", Unit: "ms"},
+		},
+		{
+			name:     "interval columns are in seconds",
+			schema:   &bigquery.FieldSchema{Name: "duration", Type: bigquery.IntervalFieldType},
+			expected: &data.FieldConfig{Unit: "s"},
+		},
+		{
+			name:                 "unit from column name",
+			schema:               &bigquery.FieldSchema{Name: "Response_Bytes", Type: bigquery.IntegerFieldType},
+			unitsFromColumnNames: true,
+			expected:             &data.FieldConfig{Unit: "bytes"},
+		},
+		{
+			name:     "column name ignored unless enabled",
+			schema:   &bigquery.FieldSchema{Name: "response_bytes", Type: bigquery.IntegerFieldType},
+			expected: nil,
+		},
+		{
+			name:                 "column name ignored for non-numeric columns",
+			schema:               &bigquery.FieldSchema{Name: "region_usd", Type: bigquery.StringFieldType},
+			unitsFromColumnNames: true,
+			expected:             nil,
+		},
+		{
+			name:                 "unit tag takes precedence over column name",
+			schema:               &bigquery.FieldSchema{Name: "latency_ms", Type: bigquery.FloatFieldType, Description: "[unit: s]"},
+			unitsFromColumnNames: true,
+			expected:             &data.FieldConfig{Unit: "s"},
+		},
+		{
+			name: "policy tags",
+			schema: &bigquery.FieldSchema{Name: "email", Type: bigquery.StringFieldType, Description: "Contact email", PolicyTags: &bigquery.PolicyTagList{
+				Names: []string{"projects/p/locations/us/taxonomies/1/policyTags/2"},
+			}},
+			expected: &data.FieldConfig{
+				Description: "Contact email\n\nProtected by column-level security (policy tags: projects/p/locations/us/taxonomies/1/policyTags/2). Values may be masked.",
+				Custom:      map[string]interface{}{"policyTags": []string{"projects/p/locations/us/taxonomies/1/policyTags/2"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, fieldConfigFromSchema(tt.schema, tt.unitsFromColumnNames))
+		})
+	}
+}
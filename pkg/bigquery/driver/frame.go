@@ -0,0 +1,57 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// FrameFromTableRows converts rows read straight from a table, as with
+// Table.Read, into a data frame. Values are converted the same way as query
+// results, so a preview of a table matches a SELECT on it.
+func FrameFromTableRows(name string, schema bigquery.Schema, values [][]bigquery.Value) (*data.Frame, error) {
+	r := &rows{rs: resultSet{data: values}}
+	for _, field := range schema {
+		r.columns = append(r.columns, field.Name)
+		r.fieldSchemas = append(r.fieldSchemas, field)
+		r.types = append(r.types, string(field.Type))
+	}
+
+	configs := r.fieldConfigs()
+	scanTypes := make([]reflect.Type, len(r.columns))
+	fields := make([]*data.Field, len(r.columns))
+	for i, column := range r.columns {
+		scanTypes[i] = r.ColumnTypeScanType(i)
+		fields[i] = data.NewFieldFromFieldType(data.FieldTypeFor(reflect.New(scanTypes[i]).Interface()), 0)
+		fields[i].Name = column
+		fields[i].Config = configs[column]
+	}
+
+	dest := make([]driver.Value, len(r.columns))
+	for {
+		if err := r.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for i, value := range dest {
+			if value == nil {
+				fields[i].Extend(1)
+				continue
+			}
+			v := reflect.ValueOf(value)
+			if !v.Type().ConvertibleTo(scanTypes[i]) {
+				return nil, fmt.Errorf("cannot convert %T value of column %q to %s", value, r.columns[i], scanTypes[i])
+			}
+			pointer := reflect.New(scanTypes[i])
+			pointer.Elem().Set(v.Convert(scanTypes[i]))
+			fields[i].Append(pointer.Interface())
+		}
+	}
+
+	return data.NewFrame(name, fields...), nil
+}
@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameFromTableRows(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+		{Name: "amount", Type: bigquery.NumericFieldType, Description: "Order amount"},
+		{Name: "created_at", Type: bigquery.TimestampFieldType},
+		{Name: "payload", Type: bigquery.JSONFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "customer", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}}},
+	}
+	values := [][]bigquery.Value{
+		{int64(1), big.NewRat(25, 2), ts, `{"a":1}`, []bigquery.Value{"x", "y"}, []bigquery.Value{"Ada"}},
+		{int64(2), nil, nil, nil, []bigquery.Value{}, nil},
+	}
+
+	frame, err := FrameFromTableRows("orders", schema, values)
+	require.NoError(t, err)
+	require.Equal(t, 2, frame.Rows())
+	assert.Equal(t, "orders", frame.Name)
+
+	types := make([]data.FieldType, len(frame.Fields))
+	for i, field := range frame.Fields {
+		types[i] = field.Type()
+	}
+	assert.Equal(t, []data.FieldType{
+		data.FieldTypeNullableInt64,
+		data.FieldTypeNullableFloat64,
+		data.FieldTypeNullableTime,
+		data.FieldTypeNullableJSON,
+		data.FieldTypeNullableString,
+		data.FieldTypeNullableString,
+	}, types)
+
+	assert.Equal(t, int64(1), *frame.Fields[0].At(0).(*int64))
+	assert.Equal(t, 12.5, *frame.Fields[1].At(0).(*float64))
+	assert.Equal(t, ts, *frame.Fields[2].At(0).(*time.Time))
+	assert.Equal(t, json.RawMessage(`{"a":1}`), *frame.Fields[3].At(0).(*json.RawMessage))
+	assert.Equal(t, `{"name":"Ada"}`, *frame.Fields[5].At(0).(*string))
+	assert.Equal(t, "Order amount", frame.Fields[1].Config.Description)
+
+	// Nulls stay null
+	assert.Nil(t, frame.Fields[1].At(1).(*float64))
+	assert.Nil(t, frame.Fields[2].At(1).(*time.Time))
+	assert.Nil(t, frame.Fields[3].At(1).(*json.RawMessage))
+}
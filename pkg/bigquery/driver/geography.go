@@ -0,0 +1,246 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geoJSONGeometry is a GeoJSON geometry object as described in RFC 7946.
+// Coordinates holds a position ([]float64) or nested slices of positions,
+// depending on the geometry type.
+type geoJSONGeometry struct {
+	Type        string
+	Coordinates any
+	Geometries  []geoJSONGeometry
+}
+
+func (g geoJSONGeometry) MarshalJSON() ([]byte, error) {
+	if g.Type == "GeometryCollection" {
+		geometries := g.Geometries
+		if geometries == nil {
+			geometries = []geoJSONGeometry{}
+		}
+		return json.Marshal(struct {
+			Type       string            `json:"type"`
+			Geometries []geoJSONGeometry `json:"geometries"`
+		}{g.Type, geometries})
+	}
+
+	coordinates := g.Coordinates
+	if coordinates == nil {
+		// Empty geometries are represented with an empty coordinates array
+		coordinates = []float64{}
+	}
+	return json.Marshal(struct {
+		Type        string `json:"type"`
+		Coordinates any    `json:"coordinates"`
+	}{g.Type, coordinates})
+}
+
+// point returns the longitude and latitude of a non-empty Point geometry
+func (g geoJSONGeometry) point() (lon float64, lat float64, ok bool) {
+	if g.Type != "Point" {
+		return 0, 0, false
+	}
+	position, ok := g.Coordinates.([]float64)
+	if !ok || len(position) < 2 {
+		return 0, 0, false
+	}
+	return position[0], position[1], true
+}
+
+var wktGeometryTypes = map[string]string{
+	"POINT":              "Point",
+	"LINESTRING":         "LineString",
+	"POLYGON":            "Polygon",
+	"MULTIPOINT":         "MultiPoint",
+	"MULTILINESTRING":    "MultiLineString",
+	"MULTIPOLYGON":       "MultiPolygon",
+	"GEOMETRYCOLLECTION": "GeometryCollection",
+}
+
+// parseWKT parses a well-known text geometry, as returned by BigQuery for
+// GEOGRAPHY values, into a GeoJSON geometry
+func parseWKT(wkt string) (geoJSONGeometry, error) {
+	p := &wktParser{input: wkt}
+	geometry, err := p.geometry()
+	if err != nil {
+		return geoJSONGeometry{}, fmt.Errorf("invalid WKT geography %q: %w", wkt, err)
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return geoJSONGeometry{}, fmt.Errorf("invalid WKT geography %q: unexpected trailing input at position %d", wkt, p.pos)
+	}
+	return geometry, nil
+}
+
+type wktParser struct {
+	input string
+	pos   int
+}
+
+func (p *wktParser) skipSpaces() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character without consuming it, or 0 at the end of the input
+func (p *wktParser) peek() byte {
+	p.skipSpaces()
+	if p.pos == len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *wktParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at position %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) word() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return strings.ToUpper(p.input[start:p.pos])
+}
+
+func (p *wktParser) number() (float64, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) && strings.ContainsRune("0123456789+-.eE", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("expected a number at position %d", start)
+	}
+	return strconv.ParseFloat(p.input[start:p.pos], 64)
+}
+
+// list parses a parenthesised, comma-separated list, calling item for each element
+func (p *wktParser) list(item func() error) error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return p.expect(')')
+}
+
+func (p *wktParser) position() ([]float64, error) {
+	x, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	y, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	return []float64{x, y}, nil
+}
+
+func (p *wktParser) positions() ([][]float64, error) {
+	var res [][]float64
+	err := p.list(func() error {
+		position, err := p.position()
+		res = append(res, position)
+		return err
+	})
+	return res, err
+}
+
+func (p *wktParser) rings() ([][][]float64, error) {
+	var res [][][]float64
+	err := p.list(func() error {
+		ring, err := p.positions()
+		res = append(res, ring)
+		return err
+	})
+	return res, err
+}
+
+func (p *wktParser) geometry() (geoJSONGeometry, error) {
+	word := p.word()
+	geometryType, ok := wktGeometryTypes[word]
+	if !ok {
+		return geoJSONGeometry{}, fmt.Errorf("unsupported geometry type %q", word)
+	}
+	geometry := geoJSONGeometry{Type: geometryType}
+
+	start := p.pos
+	if p.word() == "EMPTY" {
+		return geometry, nil
+	}
+	p.pos = start
+
+	var err error
+	switch word {
+	case "POINT":
+		var positions [][]float64
+		if positions, err = p.positions(); err == nil {
+			if len(positions) != 1 {
+				return geometry, fmt.Errorf("a point must have exactly one position")
+			}
+			geometry.Coordinates = positions[0]
+		}
+	case "LINESTRING":
+		geometry.Coordinates, err = p.positions()
+	case "POLYGON", "MULTILINESTRING":
+		geometry.Coordinates, err = p.rings()
+	case "MULTIPOINT":
+		// Points may or may not be individually parenthesised: MULTIPOINT(1 2, 3 4) or MULTIPOINT((1 2), (3 4))
+		var positions [][]float64
+		err = p.list(func() error {
+			var position []float64
+			var err error
+			if p.peek() == '(' {
+				var wrapped [][]float64
+				if wrapped, err = p.positions(); err == nil && len(wrapped) != 1 {
+					err = fmt.Errorf("a point must have exactly one position")
+				}
+				if err == nil {
+					position = wrapped[0]
+				}
+			} else {
+				position, err = p.position()
+			}
+			positions = append(positions, position)
+			return err
+		})
+		geometry.Coordinates = positions
+	case "MULTIPOLYGON":
+		var polygons [][][][]float64
+		err = p.list(func() error {
+			polygon, err := p.rings()
+			polygons = append(polygons, polygon)
+			return err
+		})
+		geometry.Coordinates = polygons
+	case "GEOMETRYCOLLECTION":
+		err = p.list(func() error {
+			member, err := p.geometry()
+			geometry.Geometries = append(geometry.Geometries, member)
+			return err
+		})
+	}
+	return geometry, err
+}
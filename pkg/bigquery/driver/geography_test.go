@@ -0,0 +1,106 @@
+package driver
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ConvertGeographyValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         bigquery.Value
+		expectedValue any
+		expectedErr   string
+	}{
+		{
+			name:          "null",
+			value:         nil,
+			expectedValue: nil,
+		},
+		{
+			name:          "point",
+			value:         bigquery.Value("POINT(-122.35 47.62)"),
+			expectedValue: `{"type":"Point","coordinates":[-122.35,47.62]}`,
+		},
+		{
+			name:          "empty point",
+			value:         bigquery.Value("POINT EMPTY"),
+			expectedValue: `{"type":"Point","coordinates":[]}`,
+		},
+		{
+			name:          "linestring",
+			value:         bigquery.Value("LINESTRING(1 2, 3 4)"),
+			expectedValue: `{"type":"LineString","coordinates":[[1,2],[3,4]]}`,
+		},
+		{
+			name:          "polygon with a hole",
+			value:         bigquery.Value("POLYGON((0 0, 10 0, 10 10, 0 0), (1 1, 2 1, 2 2, 1 1))"),
+			expectedValue: `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]],[[1,1],[2,1],[2,2],[1,1]]]}`,
+		},
+		{
+			name:          "multipoint without parentheses",
+			value:         bigquery.Value("MULTIPOINT(1 2, 3 4)"),
+			expectedValue: `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`,
+		},
+		{
+			name:          "multipoint with parentheses",
+			value:         bigquery.Value("MULTIPOINT((1 2), (3 4))"),
+			expectedValue: `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`,
+		},
+		{
+			name:          "multilinestring",
+			value:         bigquery.Value("MULTILINESTRING((1 2, 3 4), (5 6, 7 8))"),
+			expectedValue: `{"type":"MultiLineString","coordinates":[[[1,2],[3,4]],[[5,6],[7,8]]]}`,
+		},
+		{
+			name:          "multipolygon",
+			value:         bigquery.Value("MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))"),
+			expectedValue: `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`,
+		},
+		{
+			name:          "geometry collection",
+			value:         bigquery.Value("GEOMETRYCOLLECTION(POINT(1 2), LINESTRING(3 4, 5 6))"),
+			expectedValue: `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2]},{"type":"LineString","coordinates":[[3,4],[5,6]]}]}`,
+		},
+		{
+			name:          "empty geometry collection",
+			value:         bigquery.Value("GEOMETRYCOLLECTION EMPTY"),
+			expectedValue: `{"type":"GeometryCollection","geometries":[]}`,
+		},
+		{
+			name:        "unknown geometry type",
+			value:       bigquery.Value("CIRCLE(1 2, 3)"),
+			expectedErr: `unsupported geometry type "CIRCLE"`,
+		},
+		{
+			name:        "unterminated geometry",
+			value:       bigquery.Value("POINT(1 2"),
+			expectedErr: "expected ')'",
+		},
+		{
+			name:        "trailing input",
+			value:       bigquery.Value("POINT(1 2) POINT(3 4)"),
+			expectedErr: "unexpected trailing input",
+		},
+		{
+			name:        "not a string",
+			value:       bigquery.Value(42),
+			expectedErr: "unsupported GEOGRAPHY value 42 of type int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ConvertGeographyValue(tt.value)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedValue, v)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	bq "cloud.google.com/go/bigquery"
+)
+
+// DefaultAllowedStatementTypes are the statement types read-only mode allows
+// when none are configured
+var DefaultAllowedStatementTypes = []string{"SELECT"}
+
+var statementTypePattern = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// StatementTypeError is returned when read-only mode rejects a query
+type StatementTypeError struct {
+	// StatementType is the statement type reported by the dry run, empty
+	// when it could not be determined
+	StatementType string
+	Allowed       []string
+}
+
+func (e *StatementTypeError) Error() string {
+	if e.StatementType == "" {
+		return "could not determine the statement type of the query: this data source is read-only"
+	}
+	return fmt.Sprintf("%s statements are not allowed because this data source is read-only (allowed statement types: %s)", e.StatementType, strings.Join(e.Allowed, ", "))
+}
+
+// ParseStatementType validates a statement type entry of the read-only
+// allowlist, such as "SELECT" or "create_view", and returns it upper-cased.
+// Scripts, dynamic SQL and procedure calls cannot be allowed, since the dry
+// run does not report the statements they run.
+func ParseStatementType(entry string) (string, error) {
+	statementType := strings.ToUpper(strings.TrimSpace(entry))
+	if !statementTypePattern.MatchString(statementType) {
+		return "", fmt.Errorf("invalid statement type %q", entry)
+	}
+	if allowlistDeniedStatementTypes[statementType] {
+		return "", fmt.Errorf("invalid statement type %q: the statements it runs cannot be verified, so it cannot be allowed in read-only mode", entry)
+	}
+	return statementType, nil
+}
+
+// CheckStatementType verifies that the statement type reported by a dry run
+// is one of the allowed statement types, or DefaultAllowedStatementTypes when
+// none are given. Invalid entries never allow anything, so scripts, dynamic
+// SQL and procedure calls are always rejected.
+func CheckStatementType(stats *bq.QueryStatistics, allowedStatementTypes []string) error {
+	allowed := make([]string, 0, len(allowedStatementTypes))
+	for _, entry := range allowedStatementTypes {
+		if statementType, err := ParseStatementType(entry); err == nil {
+			allowed = append(allowed, statementType)
+		}
+	}
+	if len(allowedStatementTypes) == 0 {
+		allowed = DefaultAllowedStatementTypes
+	}
+
+	if stats == nil || stats.StatementType == "" {
+		return &StatementTypeError{Allowed: allowed}
+	}
+	if !slices.Contains(allowed, stats.StatementType) {
+		return &StatementTypeError{StatementType: stats.StatementType, Allowed: allowed}
+	}
+	return nil
+}
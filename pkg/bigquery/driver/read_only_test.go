@@ -0,0 +1,80 @@
+package driver
+
+import (
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+)
+
+func TestCheckStatementType(t *testing.T) {
+	tests := []struct {
+		name          string
+		stats         *bq.QueryStatistics
+		allowed       []string
+		wantErr       string
+		wantStatement string
+	}{
+		{name: "select by default", stats: &bq.QueryStatistics{StatementType: "SELECT"}},
+		{name: "DML rejected by default", stats: &bq.QueryStatistics{StatementType: "DELETE"}, wantErr: "DELETE statements are not allowed because this data source is read-only (allowed statement types: SELECT)", wantStatement: "DELETE"},
+		{name: "DDL rejected by default", stats: &bq.QueryStatistics{StatementType: "CREATE_TABLE_AS_SELECT"}, wantErr: "CREATE_TABLE_AS_SELECT statements are not allowed", wantStatement: "CREATE_TABLE_AS_SELECT"},
+		{name: "configured types", stats: &bq.QueryStatistics{StatementType: "CREATE_VIEW"}, allowed: []string{"select", "create_view"}},
+		{name: "configured types replace the default", stats: &bq.QueryStatistics{StatementType: "SELECT"}, allowed: []string{"CREATE_VIEW"}, wantErr: "allowed statement types: CREATE_VIEW", wantStatement: "SELECT"},
+		{name: "scripts cannot be allowed", stats: &bq.QueryStatistics{StatementType: "SCRIPT"}, allowed: []string{"SELECT", "SCRIPT"}, wantErr: "SCRIPT statements are not allowed", wantStatement: "SCRIPT"},
+		{name: "missing statistics", wantErr: "could not determine the statement type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckStatementType(tt.stats, tt.allowed)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var statementTypeErr *StatementTypeError
+			require.ErrorAs(t, err, &statementTypeErr)
+			assert.Equal(t, tt.wantStatement, statementTypeErr.StatementType)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseStatementType(t *testing.T) {
+	statementType, err := ParseStatementType(" create_view ")
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE_VIEW", statementType)
+
+	_, err = ParseStatementType("CREATE VIEW")
+	assert.ErrorContains(t, err, `invalid statement type "CREATE VIEW"`)
+	for _, entry := range []string{"SCRIPT", "EXECUTE_IMMEDIATE", "call"} {
+		_, err = ParseStatementType(entry)
+		assert.ErrorContains(t, err, "cannot be allowed in read-only mode")
+	}
+}
+
+func TestEnforceQueryRestrictionsReadOnly(t *testing.T) {
+	cache := fakeVerdictCache{
+		statementTypeVerdictKey("DELETE FROM sales.orders WHERE true"): &StatementTypeError{StatementType: "DELETE", Allowed: DefaultAllowedStatementTypes},
+	}
+	// Without a client, any dry run would panic
+	c := &Conn{cfg: &types.ConnectionSettings{ReadOnly: true, AllowlistVerdicts: cache}}
+
+	assert.ErrorContains(t, c.enforceQueryRestrictions(t.Context(), "DELETE FROM sales.orders WHERE true"), "read-only")
+	// Statement type verdicts only serve the exact query, as a query that
+	// normalizes like an allowed one may lex into other statements
+	harmless := "SELECT 'a', 'b', 'c', 'd', 'e' x FROM ok.ds.t"
+	smuggled := `SELECT r'\', ' x; DELETE FROM ok.ds.t WHERE true; SELECT 1 --' x FROM ok.ds.t`
+	cache[statementTypeVerdictKey(harmless)] = nil
+	cache[datasetVerdictKey(harmless)] = nil
+	c.cfg.RestrictToAccessibleDatasets = true
+	assert.NoError(t, c.enforceQueryRestrictions(t.Context(), harmless))
+	cache[datasetVerdictKey(smuggled)] = nil
+	assert.Panics(t, func() { _ = c.enforceQueryRestrictions(t.Context(), smuggled) })
+	c.cfg.RestrictToAccessibleDatasets = false
+	// Disabled restrictions never dry-run the query
+	c.cfg.ReadOnly = false
+	assert.NoError(t, c.enforceQueryRestrictions(t.Context(), "DROP TABLE sales.orders"))
+}
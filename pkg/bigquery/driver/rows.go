@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"io"
 	"reflect"
-	"time"
+	"slices"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 type resultSet struct {
@@ -18,10 +19,15 @@ type resultSet struct {
 }
 
 type rows struct {
-	columns       []string
-	fieldSchemas  []*bigquery.FieldSchema
-	types         []string
-	rs            resultSet
+	columns      []string
+	fieldSchemas []*bigquery.FieldSchema
+	types        []string
+	rs           resultSet
+
+	// geographyAsGeoJSON converts GEOGRAPHY values from WKT to GeoJSON geometries
+	geographyAsGeoJSON bool
+	// unitsFromColumnNames derives the unit of numeric columns from their name suffix
+	unitsFromColumnNames bool
 }
 
 func (r *rows) Columns() []string {
@@ -42,13 +48,19 @@ func (r *rows) Next(dest []driver.Value) error {
 	}
 
 	for i, bgValue := range r.rs.data[r.rs.num] {
-		res, err := ConvertColumnValue(bgValue, r.fieldSchemas[i])
+		var res driver.Value
+		var err error
+		if r.geographyAsGeoJSON && r.fieldSchemas[i].Type == "GEOGRAPHY" && !r.fieldSchemas[i].Repeated {
+			res, err = ConvertGeographyValue(bgValue)
+		} else {
+			res, err = ConvertColumnValue(bgValue, r.fieldSchemas[i])
+		}
 
 		if err != nil {
 			return err
 		}
 
-		if r.fieldSchemas[i].Type == "RECORD" {
+		if r.fieldSchemas[i].Type == "RECORD" || r.fieldSchemas[i].Type == "STRUCT" {
 			json, err := json.Marshal(res)
 			if err != nil {
 				return err
@@ -62,44 +74,284 @@ func (r *rows) Next(dest []driver.Value) error {
 	return nil
 }
 
+// splitRangeColumns replaces every RANGE column with a pair of TIMESTAMP
+// columns holding the start and end of the range, named after the column with
+// "_start" and "_end" suffixes, so ranges can be drawn on time-based panels.
+// Unbounded ends are null. Repeated ranges are left as strings.
+func (r *rows) splitRangeColumns() error {
+	for i := len(r.fieldSchemas) - 1; i >= 0; i-- {
+		schema := r.fieldSchemas[i]
+		if schema.Type != bigquery.RangeFieldType || schema.Repeated {
+			continue
+		}
+
+		for j, row := range r.rs.data {
+			var start, end bigquery.Value
+			if rangeValue, ok := row[i].(*bigquery.RangeValue); ok {
+				var err error
+				if start, err = ConvertRangeBound(rangeValue.Start); err != nil {
+					return err
+				}
+				if end, err = ConvertRangeBound(rangeValue.End); err != nil {
+					return err
+				}
+			}
+			r.rs.data[j] = slices.Replace(row, i, i+1, start, end)
+		}
+
+		name := r.columns[i]
+		r.columns = slices.Replace(r.columns, i, i+1, name+"_start", name+"_end")
+		r.fieldSchemas = slices.Replace(r.fieldSchemas, i, i+1,
+			&bigquery.FieldSchema{Name: name + "_start", Type: bigquery.TimestampFieldType},
+			&bigquery.FieldSchema{Name: name + "_end", Type: bigquery.TimestampFieldType},
+		)
+		r.types = slices.Replace(r.types, i, i+1, string(bigquery.TimestampFieldType), string(bigquery.TimestampFieldType))
+	}
+	return nil
+}
+
+// extractJSONKeys adds a column for every top-level key of the objects held in
+// JSON columns, named after the column and the key ("payload.status") and
+// inserted right after the JSON column. Keys whose values are all numbers,
+// strings or booleans get a FLOAT64, STRING or BOOL column; any other mix of
+// values is kept as JSON. Rows without the key are null.
+func (r *rows) extractJSONKeys() {
+	taken := make(map[string]bool, len(r.columns))
+	for _, name := range r.columns {
+		taken[name] = true
+	}
+
+	for i := len(r.fieldSchemas) - 1; i >= 0; i-- {
+		schema := r.fieldSchemas[i]
+		if schema.Type != bigquery.JSONFieldType || schema.Repeated {
+			continue
+		}
+
+		objects := make([]map[string]json.RawMessage, len(r.rs.data))
+		var keys []string
+		keyTypes := make(map[string]bigquery.FieldType)
+		for j, row := range r.rs.data {
+			value, ok := row[i].(string)
+			if !ok || json.Unmarshal([]byte(value), &objects[j]) != nil {
+				continue
+			}
+			for key, raw := range objects[j] {
+				valueType := jsonValueType(raw)
+				current, seen := keyTypes[key]
+				if !seen {
+					keys = append(keys, key)
+					current = valueType
+				} else if current == "" {
+					current = valueType
+				} else if valueType != "" && valueType != current {
+					current = bigquery.JSONFieldType
+				}
+				keyTypes[key] = current
+			}
+		}
+		slices.Sort(keys)
+
+		var names []string
+		var schemas []*bigquery.FieldSchema
+		var types []string
+		var extracted []string
+		for _, key := range keys {
+			name := r.columns[i] + "." + key
+			if taken[name] {
+				continue
+			}
+			taken[name] = true
+			fieldType := keyTypes[key]
+			if fieldType == "" {
+				// Only ever null
+				fieldType = bigquery.JSONFieldType
+			}
+			names = append(names, name)
+			schemas = append(schemas, &bigquery.FieldSchema{Name: name, Type: fieldType})
+			types = append(types, string(fieldType))
+			extracted = append(extracted, key)
+		}
+		if len(extracted) == 0 {
+			continue
+		}
+
+		for j, row := range r.rs.data {
+			values := make([]bigquery.Value, len(extracted))
+			for k, key := range extracted {
+				values[k] = jsonValue(objects[j][key], schemas[k].Type)
+			}
+			r.rs.data[j] = slices.Insert(row, i+1, values...)
+		}
+		r.columns = slices.Insert(r.columns, i+1, names...)
+		r.fieldSchemas = slices.Insert(r.fieldSchemas, i+1, schemas...)
+		r.types = slices.Insert(r.types, i+1, types...)
+	}
+}
+
+// jsonValueType returns the column type for a JSON value, or an empty type for null
+func jsonValueType(raw json.RawMessage) bigquery.FieldType {
+	var value any
+	if json.Unmarshal(raw, &value) != nil {
+		return bigquery.JSONFieldType
+	}
+	switch value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return bigquery.FloatFieldType
+	case string:
+		return bigquery.StringFieldType
+	case bool:
+		return bigquery.BooleanFieldType
+	default:
+		return bigquery.JSONFieldType
+	}
+}
+
+// jsonValue converts a JSON value to a value of the given column type
+func jsonValue(raw json.RawMessage, fieldType bigquery.FieldType) bigquery.Value {
+	if raw == nil || jsonValueType(raw) == "" {
+		return nil
+	}
+	if fieldType == bigquery.JSONFieldType {
+		return string(raw)
+	}
+	var value any
+	if json.Unmarshal(raw, &value) != nil {
+		return nil
+	}
+	return value
+}
+
+// fieldConfigs returns the field config derived from the BigQuery schema of
+// each column, keyed by column name. Columns without any are omitted.
+func (r *rows) fieldConfigs() map[string]*data.FieldConfig {
+	configs := make(map[string]*data.FieldConfig)
+	for i, schema := range r.fieldSchemas {
+		if config := fieldConfigFromSchema(schema, r.unitsFromColumnNames); config != nil {
+			configs[r.columns[i]] = config
+		}
+	}
+	return configs
+}
+
+// appendPointCoordinates adds numeric latitude and longitude columns for every
+// GEOGRAPHY column that only holds points, so the Geomap panel can plot them
+// without ST_X/ST_Y in the query. A single point column gets plain "latitude"
+// and "longitude" columns, which Geomap detects automatically; when there are
+// several, or those names are taken, they are prefixed with the column name.
+func (r *rows) appendPointCoordinates() {
+	type pointColumn struct {
+		index      int
+		latitudes  []bigquery.Value
+		longitudes []bigquery.Value
+	}
+
+	var pointColumns []pointColumn
+	taken := make(map[string]bool, len(r.columns))
+	for i, schema := range r.fieldSchemas {
+		taken[r.columns[i]] = true
+		if schema.Type != "GEOGRAPHY" || schema.Repeated {
+			continue
+		}
+		if latitudes, longitudes, ok := r.pointCoordinates(i); ok {
+			pointColumns = append(pointColumns, pointColumn{index: i, latitudes: latitudes, longitudes: longitudes})
+		}
+	}
+
+	for _, column := range pointColumns {
+		latitudeName, longitudeName := "latitude", "longitude"
+		if len(pointColumns) > 1 || taken[latitudeName] || taken[longitudeName] {
+			latitudeName = r.columns[column.index] + "_latitude"
+			longitudeName = r.columns[column.index] + "_longitude"
+		}
+
+		for _, name := range []string{latitudeName, longitudeName} {
+			r.columns = append(r.columns, name)
+			r.fieldSchemas = append(r.fieldSchemas, &bigquery.FieldSchema{Name: name, Type: bigquery.FloatFieldType})
+			r.types = append(r.types, string(bigquery.FloatFieldType))
+		}
+		for j := range r.rs.data {
+			r.rs.data[j] = append(r.rs.data[j], column.latitudes[j], column.longitudes[j])
+		}
+	}
+}
+
+// pointCoordinates returns the latitude and longitude of every row of a
+// GEOGRAPHY column, or false if the column holds anything other than points
+// and nulls, or no points at all.
+func (r *rows) pointCoordinates(index int) ([]bigquery.Value, []bigquery.Value, bool) {
+	latitudes := make([]bigquery.Value, len(r.rs.data))
+	longitudes := make([]bigquery.Value, len(r.rs.data))
+	found := false
+
+	for j, row := range r.rs.data {
+		if row[index] == nil {
+			continue
+		}
+		wkt, ok := row[index].(string)
+		if !ok {
+			return nil, nil, false
+		}
+		geometry, err := parseWKT(wkt)
+		if err != nil {
+			return nil, nil, false
+		}
+		lon, lat, ok := geometry.point()
+		if !ok {
+			return nil, nil, false
+		}
+		latitudes[j], longitudes[j] = lat, lon
+		found = true
+	}
+
+	return latitudes, longitudes, found
+}
+
 func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
 	return r.types[index]
 }
 
 func (r *rows) bigqueryTypeOf(columnType *string) (reflect.Type, error) {
-	switch *columnType {
-	case "TINYINT", "SMALLINT", "INT", "INTEGER", "INT64":
-		return reflect.TypeOf(int64(0)), nil
-	case "FLOAT", "FLOAT64", "NUMERIC", "BIGNUMERIC":
-		return reflect.TypeOf(float64(0)), nil
-	case "STRING", "BYTES":
-		return reflect.TypeOf(""), nil
-	case "BOOLEAN":
-		return reflect.TypeOf(false), nil
-	case "TIMESTAMP":
-		return reflect.TypeOf(time.Time{}), nil
-	case "JSON", "INTERVAL", "RANGE":
-		return reflect.TypeOf(""), nil
-	case "DATE", "TIME", "DATETIME":
-		return reflect.TypeOf(""), nil
-	case "RECORD", "GEOGRAPHY":
-		return reflect.TypeOf(""), nil
-	default:
-		return nil, fmt.Errorf("unknown column type `%s`", *columnType)
+	if t, ok := columnTypes[*columnType]; ok {
+		return t.scanType, nil
 	}
+	return nil, fmt.Errorf("unknown column type `%s`", *columnType)
 }
 
 func (r *rows) ColumnTypeScanType(index int) reflect.Type {
 	columnType := r.types[index]
 
 	if r.fieldSchemas[index].Repeated {
-		return reflect.TypeOf("")
+		return stringScanType
 	}
 
 	convertedBigqueryData, err := r.bigqueryTypeOf(&columnType)
 	if err != nil {
-		log.DefaultLogger.Error(err.Error())
+		// Values of unknown types are converted to strings
+		log.DefaultLogger.Warn(err.Error())
+		return stringScanType
 	}
 
 	return convertedBigqueryData
 }
+
+// ColumnTypeNullable reports NULLABLE and REPEATED columns as nullable and
+// REQUIRED columns as not nullable
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return !r.fieldSchemas[index].Required, true
+}
+
+// ColumnTypePrecisionScale returns the precision and scale of NUMERIC and
+// BIGNUMERIC columns, using BigQuery's defaults for unparameterized columns
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	schema := r.fieldSchemas[index]
+	defaults, isNumeric := defaultPrecisionScale[r.types[index]]
+	if !isNumeric || schema.Repeated {
+		return 0, 0, false
+	}
+	if schema.Precision > 0 {
+		return schema.Precision, schema.Scale, true
+	}
+	return defaults[0], defaults[1], true
+}
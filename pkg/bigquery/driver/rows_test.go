@@ -0,0 +1,205 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rows_splitRangeColumns(t *testing.T) {
+	shiftStart := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	shiftEnd := time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC)
+
+	r := &rows{
+		columns: []string{"engineer", "shift", "days", "tags"},
+		fieldSchemas: []*bigquery.FieldSchema{
+			{Name: "engineer", Type: bigquery.StringFieldType},
+			{Name: "shift", Type: bigquery.RangeFieldType, RangeElementType: &bigquery.RangeElementType{Type: bigquery.TimestampFieldType}},
+			{Name: "days", Type: bigquery.RangeFieldType, RangeElementType: &bigquery.RangeElementType{Type: bigquery.DateFieldType}},
+			{Name: "tags", Type: bigquery.RangeFieldType, Repeated: true, RangeElementType: &bigquery.RangeElementType{Type: bigquery.DateFieldType}},
+		},
+		types: []string{"STRING", "RANGE", "RANGE", "RANGE"},
+		rs: resultSet{data: [][]bigquery.Value{
+			{"alice", &bigquery.RangeValue{Start: shiftStart, End: shiftEnd}, &bigquery.RangeValue{Start: civil.Date{Year: 2024, Month: 3, Day: 1}}, nil},
+			{"bob", nil, nil, nil},
+		}},
+	}
+	require.NoError(t, r.splitRangeColumns())
+
+	assert.Equal(t, []string{"engineer", "shift_start", "shift_end", "days_start", "days_end", "tags"}, r.columns)
+	assert.Equal(t, []string{"STRING", "TIMESTAMP", "TIMESTAMP", "TIMESTAMP", "TIMESTAMP", "RANGE"}, r.types)
+
+	dest := make([]driver.Value, len(r.columns))
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{"alice", shiftStart, shiftEnd, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), nil, nil}, dest)
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{"bob", nil, nil, nil, nil, nil}, dest)
+
+	assert.Equal(t, reflect.TypeOf(time.Time{}), r.ColumnTypeScanType(1))
+}
+
+func Test_rows_fieldConfigs(t *testing.T) {
+	r := &rows{
+		columns: []string{"name", "duration"},
+		fieldSchemas: []*bigquery.FieldSchema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "duration", Type: bigquery.IntervalFieldType},
+		},
+	}
+
+	assert.Equal(t, map[string]*data.FieldConfig{"duration": {Unit: "s"}}, r.fieldConfigs())
+}
+
+func Test_rows_appendPointCoordinates(t *testing.T) {
+	newRows := func(columns []string, types []bigquery.FieldType, data [][]bigquery.Value) *rows {
+		r := &rows{rs: resultSet{data: data}, geographyAsGeoJSON: true}
+		for i, name := range columns {
+			r.columns = append(r.columns, name)
+			r.fieldSchemas = append(r.fieldSchemas, &bigquery.FieldSchema{Name: name, Type: types[i]})
+			r.types = append(r.types, string(types[i]))
+		}
+		return r
+	}
+
+	t.Run("single point column gets latitude and longitude columns", func(t *testing.T) {
+		r := newRows([]string{"name", "position"}, []bigquery.FieldType{bigquery.StringFieldType, bigquery.GeographyFieldType}, [][]bigquery.Value{
+			{"truck-1", "POINT(-122.35 47.62)"},
+			{"truck-2", nil},
+		})
+		r.appendPointCoordinates()
+
+		assert.Equal(t, []string{"name", "position", "latitude", "longitude"}, r.columns)
+		assert.Equal(t, []string{"STRING", "GEOGRAPHY", "FLOAT", "FLOAT"}, r.types)
+
+		dest := make([]driver.Value, len(r.columns))
+		require.NoError(t, r.Next(dest))
+		assert.Equal(t, []driver.Value{"truck-1", `{"type":"Point","coordinates":[-122.35,47.62]}`, 47.62, -122.35}, dest)
+		require.NoError(t, r.Next(dest))
+		assert.Equal(t, []driver.Value{"truck-2", nil, nil, nil}, dest)
+	})
+
+	t.Run("several point columns get prefixed columns", func(t *testing.T) {
+		r := newRows([]string{"origin", "destination"}, []bigquery.FieldType{bigquery.GeographyFieldType, bigquery.GeographyFieldType}, [][]bigquery.Value{
+			{"POINT(1 2)", "POINT(3 4)"},
+		})
+		r.appendPointCoordinates()
+
+		assert.Equal(t, []string{"origin", "destination", "origin_latitude", "origin_longitude", "destination_latitude", "destination_longitude"}, r.columns)
+		assert.Equal(t, []bigquery.Value{"POINT(1 2)", "POINT(3 4)", float64(2), float64(1), float64(4), float64(3)}, r.rs.data[0])
+	})
+
+	t.Run("existing latitude column forces prefixed names", func(t *testing.T) {
+		r := newRows([]string{"latitude", "position"}, []bigquery.FieldType{bigquery.FloatFieldType, bigquery.GeographyFieldType}, [][]bigquery.Value{
+			{float64(0), "POINT(1 2)"},
+		})
+		r.appendPointCoordinates()
+
+		assert.Equal(t, []string{"latitude", "position", "position_latitude", "position_longitude"}, r.columns)
+	})
+
+	t.Run("columns with other geometries are left alone", func(t *testing.T) {
+		r := newRows([]string{"area"}, []bigquery.FieldType{bigquery.GeographyFieldType}, [][]bigquery.Value{
+			{"POINT(1 2)"},
+			{"POLYGON((0 0, 1 0, 1 1, 0 0))"},
+		})
+		r.appendPointCoordinates()
+
+		assert.Equal(t, []string{"area"}, r.columns)
+	})
+
+	t.Run("columns without any points are left alone", func(t *testing.T) {
+		r := newRows([]string{"position"}, []bigquery.FieldType{bigquery.GeographyFieldType}, [][]bigquery.Value{
+			{nil},
+		})
+		r.appendPointCoordinates()
+
+		assert.Equal(t, []string{"position"}, r.columns)
+	})
+}
+
+func Test_rows_extractJSONKeys(t *testing.T) {
+	r := &rows{
+		columns: []string{"id", "payload"},
+		fieldSchemas: []*bigquery.FieldSchema{
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "payload", Type: bigquery.JSONFieldType},
+		},
+		types: []string{"INTEGER", "JSON"},
+		rs: resultSet{data: [][]bigquery.Value{
+			{int64(1), `{"status": "ok", "latency": 12.5, "retried": false, "tags": ["a"], "mixed": 1}`},
+			{int64(2), `{"status": "failed", "latency": null, "mixed": "one", "extra": null}`},
+			{int64(3), nil},
+			{int64(4), `[1, 2]`},
+		}},
+	}
+	r.extractJSONKeys()
+
+	assert.Equal(t, []string{"id", "payload", "payload.extra", "payload.latency", "payload.mixed", "payload.retried", "payload.status", "payload.tags"}, r.columns)
+	assert.Equal(t, []string{"INTEGER", "JSON", "JSON", "FLOAT", "JSON", "BOOLEAN", "STRING", "JSON"}, r.types)
+
+	dest := make([]driver.Value, len(r.columns))
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{int64(1), `{"status": "ok", "latency": 12.5, "retried": false, "tags": ["a"], "mixed": 1}`, nil, 12.5, "1", false, "ok", `["a"]`}, dest)
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{int64(2), `{"status": "failed", "latency": null, "mixed": "one", "extra": null}`, nil, nil, `"one"`, nil, "failed", nil}, dest)
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{int64(3), nil, nil, nil, nil, nil, nil, nil}, dest)
+	require.NoError(t, r.Next(dest))
+	assert.Equal(t, []driver.Value{int64(4), `[1, 2]`, nil, nil, nil, nil, nil, nil}, dest)
+
+	assert.Equal(t, reflect.TypeOf(json.RawMessage{}), r.ColumnTypeScanType(1))
+}
+
+func Test_rows_columnTypes(t *testing.T) {
+	r := &rows{
+		fieldSchemas: []*bigquery.FieldSchema{
+			{Name: "a", Type: "BIGINT"},
+			{Name: "b", Type: bigquery.IntegerFieldType, Required: true},
+			{Name: "c", Type: bigquery.NumericFieldType},
+			{Name: "d", Type: bigquery.BigNumericFieldType, Precision: 50, Scale: 10},
+			{Name: "e", Type: bigquery.NumericFieldType, Repeated: true},
+			{Name: "f", Type: "UNKNOWN"},
+			{Name: "g", Type: bigquery.RecordFieldType, Required: true},
+		},
+		types: []string{"BIGINT", "INTEGER", "NUMERIC", "BIGNUMERIC", "NUMERIC", "UNKNOWN", "RECORD"},
+	}
+
+	tests := []struct {
+		scanType  reflect.Type
+		nullable  bool
+		precision int64
+		scale     int64
+		numeric   bool
+	}{
+		{scanType: reflect.TypeOf(int64(0)), nullable: true},
+		{scanType: reflect.TypeOf(int64(0)), nullable: false},
+		{scanType: reflect.TypeOf(float64(0)), nullable: true, precision: 38, scale: 9, numeric: true},
+		{scanType: reflect.TypeOf(float64(0)), nullable: true, precision: 50, scale: 10, numeric: true},
+		{scanType: reflect.TypeOf(""), nullable: true},
+		{scanType: reflect.TypeOf(""), nullable: true},
+		{scanType: reflect.TypeOf(""), nullable: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(r.fieldSchemas[i].Name, func(t *testing.T) {
+			assert.Equal(t, tt.scanType, r.ColumnTypeScanType(i))
+
+			nullable, ok := r.ColumnTypeNullable(i)
+			assert.True(t, ok)
+			assert.Equal(t, tt.nullable, nullable)
+
+			precision, scale, ok := r.ColumnTypePrecisionScale(i)
+			assert.Equal(t, tt.numeric, ok)
+			assert.Equal(t, tt.precision, precision)
+			assert.Equal(t, tt.scale, scale)
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	bq "cloud.google.com/go/bigquery"
+)
+
+// dynamicScriptKeywords start statements whose effect depends on values only
+// known when the script runs: control flow, dynamic SQL and procedure calls
+var dynamicScriptKeywords = map[string]bool{
+	"BEGIN": true, "END": true, "IF": true, "ELSEIF": true, "ELSE": true, "CASE": true, "LOOP": true,
+	"WHILE": true, "REPEAT": true, "UNTIL": true, "FOR": true, "BREAK": true, "LEAVE": true, "CONTINUE": true,
+	"ITERATE": true, "RETURN": true, "RAISE": true, "EXCEPTION": true, "CALL": true, "EXECUTE": true,
+	"COMMIT": true, "ROLLBACK": true, "ASSERT": true, "EXPORT": true, "LOAD": true,
+}
+
+// CheckAllowedQuery runs check on the dry-run statistics of a query. Dry runs
+// of multi-statement scripts do not list the tables referenced by their
+// statements, so a script made only of static statements is split and every
+// statement is dry-run with dryRun and checked on its own instead. Scripts
+// with control flow or dynamic SQL are rejected.
+func CheckAllowedQuery(ctx context.Context, stats *bq.QueryStatistics, query string, dryRun func(ctx context.Context, query string) (*bq.QueryStatistics, error), check func(stats *bq.QueryStatistics, query string) error) error {
+	if stats == nil || stats.StatementType != "SCRIPT" {
+		return check(stats, query)
+	}
+
+	dryRuns, err := scriptDryRuns(query)
+	if err != nil {
+		return &DenialError{Rule: DenialScript, err: fmt.Errorf("the script cannot be verified because this data source restricts which datasets can be queried: %w", err)}
+	}
+	for i, statement := range dryRuns {
+		if statement == "" {
+			continue
+		}
+		stats, err := dryRun(ctx, statement)
+		if err != nil {
+			return &DenialError{Rule: DenialScript, err: fmt.Errorf("statement %d of the script could not be verified: %w", i+1, err)}
+		}
+		if err := check(stats, statement); err != nil {
+			return fmt.Errorf("statement %d of the script: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// scriptDryRuns splits a script into its statements and returns, for each, a
+// standalone query referencing the same tables, or an empty string when the
+// statement references no table. Statements are dry-run one at a time, so
+// references to script state are replaced: variables by their DEFAULT
+// expression or a NULL of their type, temp tables by the query that created
+// them, and the temp functions a statement calls are defined in front of it.
+func scriptDryRuns(script string) ([]string, error) {
+	tokens, err := tokenizeSQL(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]sqlToken
+	start, depth := 0, 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+		case tok.is(";") && depth == 0:
+			if i > start {
+				groups = append(groups, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		groups = append(groups, tokens[start:])
+	}
+
+	s := &scriptState{script: script, variables: map[string]string{}, tempTables: map[string]string{}}
+	dryRuns := make([]string, 0, len(groups))
+	for i, group := range groups {
+		dryRun, err := s.statement(group)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if dryRun != "" {
+			dryRun = s.withTempFunctions(dryRun)
+		}
+		dryRuns = append(dryRuns, dryRun)
+	}
+	return dryRuns, nil
+}
+
+type scriptState struct {
+	script string
+	// variables maps variable names to the expression replacing them
+	variables map[string]string
+	// tempTables maps temp table names to the query that created them
+	tempTables map[string]string
+	// tempFunctions are the temp function definitions, in script order
+	tempFunctions []tempFunction
+}
+
+type tempFunction struct {
+	name       string
+	definition string
+}
+
+func (s *scriptState) text(tokens []sqlToken) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	return s.script[tokens[0].start:tokens[len(tokens)-1].end]
+}
+
+// statement returns the query to dry-run for a statement and records the
+// script state it declares
+func (s *scriptState) statement(tokens []sqlToken) (string, error) {
+	first := strings.ToUpper(tokens[0].text)
+	if tokens[0].kind == sqlIdentifier && dynamicScriptKeywords[first] {
+		return "", fmt.Errorf("%s statements are not supported; only scripts made of static statements can be verified", first)
+	}
+
+	switch first {
+	case "DECLARE":
+		return s.declare(tokens)
+	case "SET":
+		eq := indexAtDepth(tokens, "=")
+		if eq < 0 {
+			return "", fmt.Errorf("SET without a value")
+		}
+		// System variables such as @@dataset_id change how later statements
+		// resolve, also when set in a tuple: SET (@@a, b) = (...)
+		for _, tok := range tokens[1:eq] {
+			if tok.is("@") {
+				return "", fmt.Errorf("system variables cannot be set")
+			}
+		}
+		return "SELECT " + s.rewrite(tokens[eq+1:]), nil
+	case "CREATE":
+		return s.create(tokens)
+	case "INSERT":
+		return s.insert(tokens)
+	case "DROP":
+		// DROP TABLE [IF EXISTS] name
+		i := 1
+		if i < len(tokens) && tokens[i].is("TABLE") {
+			i++
+			if i+1 < len(tokens) && tokens[i].is("IF") && tokens[i+1].is("EXISTS") {
+				i += 2
+			}
+			if i == len(tokens)-1 && s.tempTables[strings.ToLower(tokens[i].text)] != "" {
+				return "", nil
+			}
+		}
+	}
+	return s.rewrite(tokens), nil
+}
+
+// declare handles DECLARE name[, ...] [type] [DEFAULT expression]
+func (s *scriptState) declare(tokens []sqlToken) (string, error) {
+	var names []string
+	i := 1
+	for i < len(tokens) && (tokens[i].kind == sqlIdentifier || tokens[i].kind == sqlQuotedIdentifier) {
+		names = append(names, strings.ToLower(tokens[i].text))
+		i++
+		if i < len(tokens) && tokens[i].is(",") {
+			i++
+			continue
+		}
+		break
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("DECLARE without a variable name")
+	}
+
+	typeEnd := indexAtDepth(tokens, "DEFAULT")
+	if typeEnd < 0 {
+		typeEnd = len(tokens)
+	}
+	var replacement, dryRun string
+	if typeEnd < len(tokens) {
+		expression := s.rewrite(tokens[typeEnd+1:])
+		replacement = "(" + expression + ")"
+		dryRun = "SELECT " + expression
+	}
+	if typeEnd > i {
+		replacement = "CAST(NULL AS " + s.text(tokens[i:typeEnd]) + ")"
+	}
+	if replacement == "" {
+		return "", fmt.Errorf("DECLARE without a type or a default value")
+	}
+	for _, name := range names {
+		s.variables[name] = replacement
+	}
+	return dryRun, nil
+}
+
+// create handles CREATE [OR REPLACE] TEMP TABLE and TEMP FUNCTION
+// statements. Other CREATE statements are dry-run as they are.
+func (s *scriptState) create(tokens []sqlToken) (string, error) {
+	i := 1
+	if i+1 < len(tokens) && tokens[i].is("OR") && tokens[i+1].is("REPLACE") {
+		i += 2
+	}
+	if i >= len(tokens) || (!tokens[i].is("TEMP") && !tokens[i].is("TEMPORARY")) {
+		return s.rewrite(tokens), nil
+	}
+	i++
+	if i >= len(tokens) {
+		return "", fmt.Errorf("incomplete CREATE TEMP statement")
+	}
+	kind := strings.ToUpper(tokens[i].text)
+	i++
+	if i+2 < len(tokens) && tokens[i].is("IF") && tokens[i+1].is("NOT") && tokens[i+2].is("EXISTS") {
+		i += 3
+	}
+	if i >= len(tokens) {
+		return "", fmt.Errorf("incomplete CREATE TEMP statement")
+	}
+	name := strings.ToLower(tokens[i].text)
+
+	switch kind {
+	case "FUNCTION":
+		// Functions referencing tables are checked where they are called
+		s.tempFunctions = append(s.tempFunctions, tempFunction{name: name, definition: s.rewrite(tokens)})
+		return "", nil
+	case "TABLE":
+		for j := i + 1; j+1 < len(tokens); j++ {
+			if tokens[j].is("AS") && (tokens[j+1].is("SELECT") || tokens[j+1].is("WITH") || tokens[j+1].is("(")) {
+				query := s.rewrite(tokens[j+1:])
+				s.tempTables[name] = query
+				return query, nil
+			}
+		}
+		return "", fmt.Errorf("temp tables must be created from a query with CREATE TEMP TABLE ... AS SELECT")
+	}
+	return "", fmt.Errorf("CREATE TEMP %s statements are not supported", kind)
+}
+
+// insert handles inserts into temp tables, which cannot be dry-run on their
+// own, by dry-running the inserted query. Other inserts are dry-run as they
+// are.
+func (s *scriptState) insert(tokens []sqlToken) (string, error) {
+	i := 1
+	if i < len(tokens) && tokens[i].is("INTO") {
+		i++
+	}
+	if i >= len(tokens) || s.tempTables[strings.ToLower(tokens[i].text)] == "" {
+		return s.rewrite(tokens), nil
+	}
+	i++
+	// Skip the column list
+	if i+1 < len(tokens) && tokens[i].is("(") && !tokens[i+1].is("SELECT") && !tokens[i+1].is("WITH") {
+		for depth := 0; i < len(tokens); i++ {
+			if tokens[i].is("(") {
+				depth++
+			} else if tokens[i].is(")") {
+				if depth--; depth == 0 {
+					i++
+					break
+				}
+			}
+		}
+	}
+	if i >= len(tokens) {
+		return "", fmt.Errorf("INSERT without values")
+	}
+	if tokens[i].is("VALUES") {
+		// VALUES (1, 'a'), (2, 'b') selects the same expressions as structs
+		return "SELECT " + s.rewrite(tokens[i+1:]), nil
+	}
+	return s.rewrite(tokens[i:]), nil
+}
+
+// rewrite returns the text of tokens with references to script variables and
+// temp tables replaced
+func (s *scriptState) rewrite(tokens []sqlToken) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	prev := tokens[0].start
+	for i, tok := range tokens {
+		b.WriteString(s.script[prev:tok.start])
+		prev = tok.end
+
+		name := strings.ToLower(tok.text)
+		before := func(texts ...string) bool {
+			for _, text := range texts {
+				if i > 0 && tokens[i-1].is(text) {
+					return true
+				}
+			}
+			return false
+		}
+		after := func(texts ...string) bool {
+			for _, text := range texts {
+				if i+1 < len(tokens) && tokens[i+1].is(text) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if query, ok := s.tempTables[name]; ok && (tok.kind == sqlIdentifier || tok.kind == sqlQuotedIdentifier) &&
+			before("FROM", "JOIN", ",") && !after(".") {
+			b.WriteString("(" + query + ")")
+			// Keep the table name as the alias unless the statement sets one
+			if !after("AS") && !(i+1 < len(tokens) && tokens[i+1].kind == sqlIdentifier && !reservedKeywords[strings.ToUpper(tokens[i+1].text)]) {
+				b.WriteString(" AS " + tok.text)
+			}
+			continue
+		}
+		if replacement, ok := s.variables[name]; ok && tok.kind == sqlIdentifier &&
+			!before(".", "@", "AS") && !after(".", "(") {
+			b.WriteString(replacement)
+			continue
+		}
+		b.WriteString(s.script[tok.start:tok.end])
+	}
+	return b.String()
+}
+
+// withTempFunctions defines the temp functions query calls, directly or
+// through other temp functions, in front of it
+func (s *scriptState) withTempFunctions(query string) string {
+	used := make(map[string]bool)
+	pending := []string{query}
+	for len(pending) > 0 {
+		tokens, err := tokenizeSQL(pending[0])
+		pending = pending[1:]
+		if err != nil {
+			continue
+		}
+		for i, tok := range tokens {
+			if tok.kind != sqlIdentifier || i+1 >= len(tokens) || !tokens[i+1].is("(") {
+				continue
+			}
+			for _, function := range s.tempFunctions {
+				if function.name == strings.ToLower(tok.text) && !used[function.name] {
+					used[function.name] = true
+					pending = append(pending, function.definition)
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, function := range s.tempFunctions {
+		if used[function.name] {
+			b.WriteString(function.definition + ";\n")
+		}
+	}
+	return b.String() + query
+}
+
+// indexAtDepth returns the index of the first keyword or punctuation outside
+// parentheses, or -1
+func indexAtDepth(tokens []sqlToken, text string) int {
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+		case depth == 0 && tok.is(text):
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,145 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scriptDryRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "variables are replaced by their default or a NULL of their type",
+			script: `DECLARE since DATE DEFAULT DATE_SUB(CURRENT_DATE(), INTERVAL 7 DAY);
+				DECLARE region, zone STRING;
+				DECLARE top DEFAULT (SELECT MAX(total) FROM sales.orders);
+				SET region = 'eu';
+				SELECT region, SUM(total) AS since FROM sales.orders WHERE day >= since AND total < top AND t.region = region GROUP BY region`,
+			want: []string{
+				"SELECT DATE_SUB(CURRENT_DATE(), INTERVAL 7 DAY)",
+				"",
+				"SELECT (SELECT MAX(total) FROM sales.orders)",
+				"SELECT 'eu'",
+				"SELECT CAST(NULL AS STRING), SUM(total) AS since FROM sales.orders WHERE day >= CAST(NULL AS DATE) AND total < ((SELECT MAX(total) FROM sales.orders)) AND t.region = CAST(NULL AS STRING) GROUP BY CAST(NULL AS STRING)",
+			},
+		},
+		{
+			name: "temp tables are replaced by the query creating them",
+			script: `CREATE TEMP TABLE recent AS SELECT * FROM sales.orders WHERE day > '2024-01-01';
+				INSERT INTO recent (id, total) VALUES (1, 2.5);
+				INSERT INTO recent SELECT * FROM sales.archive;
+				SELECT * FROM recent r JOIN sales.customers c ON r.id = c.id;
+				SELECT COUNT(*) FROM recent;
+				DROP TABLE IF EXISTS recent;`,
+			want: []string{
+				"SELECT * FROM sales.orders WHERE day > '2024-01-01'",
+				"SELECT (1, 2.5)",
+				"SELECT * FROM sales.archive",
+				"SELECT * FROM (SELECT * FROM sales.orders WHERE day > '2024-01-01') r JOIN sales.customers c ON r.id = c.id",
+				"SELECT COUNT(*) FROM (SELECT * FROM sales.orders WHERE day > '2024-01-01') AS recent",
+				"",
+			},
+		},
+		{
+			name: "temp functions are defined in front of the statements calling them",
+			script: `CREATE TEMP FUNCTION double(x INT64) AS (x * 2);
+				CREATE TEMP FUNCTION quadruple(x INT64) AS (double(double(x)));
+				SELECT 1;
+				SELECT quadruple(total) FROM sales.orders`,
+			want: []string{
+				"",
+				"",
+				"SELECT 1",
+				"CREATE TEMP FUNCTION double(x INT64) AS (x * 2);\nCREATE TEMP FUNCTION quadruple(x INT64) AS (double(double(x)));\nSELECT quadruple(total) FROM sales.orders",
+			},
+		},
+		{
+			name:    "dynamic SQL is rejected",
+			script:  "DECLARE t STRING DEFAULT 'sales.orders'; EXECUTE IMMEDIATE CONCAT('SELECT * FROM ', t)",
+			wantErr: "statement 2: EXECUTE statements are not supported",
+		},
+		{
+			name:    "control flow is rejected",
+			script:  "DECLARE x INT64 DEFAULT 1; IF x > 0 THEN SELECT * FROM sales.orders; END IF",
+			wantErr: "statement 2: IF statements are not supported",
+		},
+		{
+			name:    "system variables are rejected",
+			script:  "SET @@dataset_project_id = 'other'; SELECT * FROM sales.orders",
+			wantErr: "statement 1: system variables cannot be set",
+		},
+		{
+			name:    "system variables set in a tuple are rejected",
+			script:  "SET (@@dataset_project_id, @@dataset_id) = ('other', 'secret'); SELECT * FROM orders",
+			wantErr: "statement 1: system variables cannot be set",
+		},
+		{
+			name:    "temp tables without a query are rejected",
+			script:  "CREATE TEMP TABLE recent (id INT64); SELECT * FROM recent",
+			wantErr: "temp tables must be created from a query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scriptDryRuns(tt.script)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckAllowedQuery(t *testing.T) {
+	check := func(stats *bq.QueryStatistics, query string) error {
+		return CheckAllowedDatasets(stats, query, []string{"myproject"}, nil, nil, "myproject")
+	}
+	// dryRun reports the tables of the single-statement queries used below
+	dryRun := func(_ context.Context, query string) (*bq.QueryStatistics, error) {
+		switch query {
+		case "SELECT 1":
+			return &bq.QueryStatistics{StatementType: "SELECT"}, nil
+		case "SELECT * FROM sales.orders":
+			return &bq.QueryStatistics{StatementType: "SELECT", ReferencedTables: []*bq.Table{{ProjectID: "myproject", DatasetID: "sales", TableID: "orders"}}}, nil
+		case "SELECT * FROM `other.secret.data`":
+			return &bq.QueryStatistics{StatementType: "SELECT", ReferencedTables: []*bq.Table{{ProjectID: "other", DatasetID: "secret", TableID: "data"}}}, nil
+		}
+		return nil, errors.New("Syntax error")
+	}
+	script := &bq.QueryStatistics{StatementType: "SCRIPT"}
+
+	t.Run("single statements are checked directly", func(t *testing.T) {
+		stats, _ := dryRun(t.Context(), "SELECT * FROM `other.secret.data`")
+		assert.ErrorContains(t, CheckAllowedQuery(t.Context(), stats, "SELECT * FROM `other.secret.data`", dryRun, check), `"other.secret.data"`)
+	})
+
+	t.Run("static scripts are allowed when every statement is", func(t *testing.T) {
+		assert.NoError(t, CheckAllowedQuery(t.Context(), script, "SELECT 1; SELECT * FROM sales.orders", dryRun, check))
+	})
+
+	t.Run("a denied statement rejects the script", func(t *testing.T) {
+		err := CheckAllowedQuery(t.Context(), script, "SELECT 1; SELECT * FROM `other.secret.data`", dryRun, check)
+		assert.ErrorContains(t, err, `statement 2 of the script: the query references table "other.secret.data"`)
+	})
+
+	t.Run("a statement failing its dry run rejects the script", func(t *testing.T) {
+		err := CheckAllowedQuery(t.Context(), script, "SELECT 1; SELEC 2", dryRun, check)
+		assert.ErrorContains(t, err, "statement 2 of the script could not be verified: Syntax error")
+	})
+
+	t.Run("dynamic scripts are rejected", func(t *testing.T) {
+		err := CheckAllowedQuery(t.Context(), script, "CALL myproject.sales.refresh()", dryRun, check)
+		assert.ErrorContains(t, err, "the script cannot be verified")
+	})
+}
@@ -0,0 +1,351 @@
+package driver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	bq "cloud.google.com/go/bigquery"
+)
+
+// completeReferencedTables returns every table referenced by a query whose
+// dry run reported the maximum number of referenced tables, at which point
+// BigQuery truncates the list. The tables are read from the SQL instead and
+// cross-checked against the dry run: every reported table must be among them,
+// otherwise the SQL was not understood well enough to be trusted. Only plain
+// SELECT statements are supported.
+func completeReferencedTables(stats *bq.QueryStatistics, query string, defaultProject string) ([]*bq.Table, error) {
+	if stats.StatementType != "SELECT" {
+		return nil, fmt.Errorf("only SELECT statements are supported")
+	}
+
+	tables, err := tableReferencesFromSQL(query, defaultProject)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reported := range stats.ReferencedTables {
+		found := false
+		for _, table := range tables {
+			if table.ProjectID == reported.ProjectID && table.DatasetID == reported.DatasetID {
+				if matched, _ := path.Match(table.TableID, reported.TableID); matched {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("table %q is referenced but was not found in the SQL", reported.ProjectID+"."+reported.DatasetID+"."+reported.TableID)
+		}
+	}
+	return tables, nil
+}
+
+type sqlTokenKind int
+
+const (
+	sqlIdentifier sqlTokenKind = iota
+	sqlQuotedIdentifier
+	sqlLiteral
+	sqlPunctuation
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	// start and end are the byte offsets of the token in the query
+	start int
+	end   int
+}
+
+// is reports whether the token is the given keyword or punctuation
+func (t sqlToken) is(text string) bool {
+	return (t.kind == sqlIdentifier || t.kind == sqlPunctuation) && strings.EqualFold(t.text, text)
+}
+
+// tokenizeSQL splits GoogleSQL into identifiers, quoted identifiers, literals
+// and punctuation, dropping whitespace and comments. Unquoted identifiers
+// keep dashes and a trailing "*" so that references such as
+// my-project.logs.events_* stay whole.
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '`':
+			end := i + 1
+			for end < len(query) && query[end] != '`' {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated quoted identifier")
+			}
+			tokens = append(tokens, sqlToken{sqlQuotedIdentifier, query[i+1 : end], i, end + 1})
+			i = end + 1
+		case c == '\'' || c == '"':
+			end, err := skipStringLiteral(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{sqlLiteral, query[i:end], i, end})
+			i = end
+		case isIdentifierChar(c):
+			start := i
+			for i < len(query) && (isIdentifierChar(query[i]) || (query[i] == '-' && i+1 < len(query) && isIdentifierChar(query[i+1]))) {
+				i++
+			}
+			// String prefixes: r'...', b"...", rb'''...'''
+			if prefix := strings.ToLower(query[start:i]); i < len(query) && (query[i] == '\'' || query[i] == '"') &&
+				(prefix == "r" || prefix == "b" || prefix == "rb" || prefix == "br") {
+				end, err := skipStringLiteral(query, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, sqlToken{sqlLiteral, query[start:end], start, end})
+				i = end
+				continue
+			}
+			if i < len(query) && query[i] == '*' {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlIdentifier, query[start:i], start, i})
+		default:
+			tokens = append(tokens, sqlToken{sqlPunctuation, string(c), i, i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipStringLiteral returns the position after the string literal starting
+// with the quote at start, which may be triple-quoted. A backslash always
+// protects the next character, even in raw strings, so the quote in r'\'
+// does not end the string.
+func skipStringLiteral(query string, start int) (int, error) {
+	quote := query[start : start+1]
+	if strings.HasPrefix(query[start:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	for i := start + len(quote); i < len(query); i++ {
+		if query[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(query[i:], quote) {
+			return i + len(quote), nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal")
+}
+
+// reservedKeywords are the GoogleSQL reserved keywords, which cannot be used
+// as unquoted aliases
+var reservedKeywords = map[string]bool{
+	"ALL": true, "AND": true, "ANY": true, "ARRAY": true, "AS": true, "ASC": true, "ASSERT_ROWS_MODIFIED": true,
+	"AT": true, "BETWEEN": true, "BY": true, "CASE": true, "CAST": true, "COLLATE": true, "CONTAINS": true,
+	"CREATE": true, "CROSS": true, "CUBE": true, "CURRENT": true, "DEFAULT": true, "DEFINE": true, "DESC": true,
+	"DISTINCT": true, "ELSE": true, "END": true, "ENUM": true, "ESCAPE": true, "EXCEPT": true, "EXCLUDE": true,
+	"EXISTS": true, "EXTRACT": true, "FALSE": true, "FETCH": true, "FOLLOWING": true, "FOR": true, "FROM": true,
+	"FULL": true, "GROUP": true, "GROUPING": true, "GROUPS": true, "HASH": true, "HAVING": true, "IF": true,
+	"IGNORE": true, "IN": true, "INNER": true, "INTERSECT": true, "INTERVAL": true, "INTO": true, "IS": true,
+	"JOIN": true, "LATERAL": true, "LEFT": true, "LIKE": true, "LIMIT": true, "LOOKUP": true, "MERGE": true,
+	"NATURAL": true, "NEW": true, "NO": true, "NOT": true, "NULL": true, "NULLS": true, "OF": true, "ON": true,
+	"OR": true, "ORDER": true, "OUTER": true, "OVER": true, "PARTITION": true, "PRECEDING": true, "PROTO": true,
+	"QUALIFY": true, "RANGE": true, "RECURSIVE": true, "RESPECT": true, "RIGHT": true, "ROLLUP": true,
+	"ROWS": true, "SELECT": true, "SET": true, "SOME": true, "STRUCT": true, "TABLESAMPLE": true, "THEN": true,
+	"TO": true, "TREAT": true, "TRUE": true, "UNBOUNDED": true, "UNION": true, "UNNEST": true, "USING": true,
+	"WHEN": true, "WHERE": true, "WINDOW": true, "WITH": true, "WITHIN": true,
+}
+
+// fromClauseEnd are the keywords ending a FROM clause at the same nesting level
+var fromClauseEnd = map[string]bool{
+	"WHERE": true, "GROUP": true, "HAVING": true, "QUALIFY": true, "WINDOW": true, "ORDER": true,
+	"LIMIT": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "SELECT": true,
+}
+
+// tableReferencesFromSQL returns the tables referenced in the FROM clauses of
+// a query, qualifying "dataset.table" references with defaultProject. Single
+// names must be CTEs. Paths starting with an alias, such as
+// alias.array_column, are returned as tables too: telling them apart needs
+// alias scoping, and checking one table too many only ever denies. It returns
+// an error for anything it cannot resolve with certainty, such as
+// table-valued functions.
+func tableReferencesFromSQL(query string, defaultProject string) ([]*bq.Table, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index of the matching parenthesis for every opening one
+	closing := make(map[int]int)
+	var open []int
+	for i, tok := range tokens {
+		if tok.is("(") {
+			open = append(open, i)
+		} else if tok.is(")") {
+			if len(open) == 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+			closing[open[len(open)-1]] = i
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) > 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+
+	isName := func(i int) bool {
+		return i < len(tokens) && (tokens[i].kind == sqlQuotedIdentifier ||
+			(tokens[i].kind == sqlIdentifier && !reservedKeywords[strings.ToUpper(tokens[i].text)]))
+	}
+
+	ctes := make(map[string]bool)
+
+	var paths [][]string
+	// joinParens are the opening parentheses of parenthesized joins, such as
+	// FROM (a JOIN b USING (id)), whose items are FROM items too
+	joinParens := map[int]bool{}
+	// parseFromItem records the FROM item starting at i
+	var parseFromItem func(i int) error
+	parseFromItem = func(i int) error {
+		if i >= len(tokens) {
+			return fmt.Errorf("missing table after FROM")
+		}
+		// Subqueries are scanned like the rest of the query
+		if tokens[i].is("UNNEST") {
+			return nil
+		}
+		if tokens[i].is("(") {
+			if i+1 < len(tokens) && (tokens[i+1].is("SELECT") || tokens[i+1].is("WITH")) {
+				return nil
+			}
+			joinParens[i] = true
+			return parseFromItem(i + 1)
+		}
+		if !isName(i) {
+			return fmt.Errorf("unsupported FROM item %q", tokens[i].text)
+		}
+
+		var parts []string
+		for {
+			if tokens[i].kind == sqlQuotedIdentifier {
+				parts = append(parts, strings.Split(tokens[i].text, ".")...)
+			} else {
+				parts = append(parts, tokens[i].text)
+			}
+			if i+2 < len(tokens) && tokens[i+1].is(".") && (tokens[i+2].kind == sqlIdentifier || tokens[i+2].kind == sqlQuotedIdentifier) {
+				i += 2
+				continue
+			}
+			break
+		}
+		if i+1 < len(tokens) && tokens[i+1].is("(") {
+			return fmt.Errorf("table-valued function %q is not supported", strings.Join(parts, "."))
+		}
+		paths = append(paths, parts)
+		return nil
+	}
+
+	depth := 0
+	inFrom := map[int]bool{}
+	extract := map[int]bool{}
+	for i, tok := range tokens {
+		switch {
+		case tok.is("("):
+			depth++
+			if joinParens[i] {
+				inFrom[depth] = true
+			}
+			if i > 0 && tokens[i-1].is("EXTRACT") {
+				extract[depth] = true
+			}
+		case tok.is(")"):
+			delete(inFrom, depth)
+			delete(extract, depth)
+			depth--
+		case tok.is("WITH") && i+1 < len(tokens) && !tokens[i+1].is("OFFSET"):
+			// CTE definitions: WITH [RECURSIVE] name AS (...), name AS (...)
+			j := i + 1
+			if j < len(tokens) && tokens[j].is("RECURSIVE") {
+				j++
+			}
+			for isName(j) && j+2 < len(tokens) && tokens[j+1].is("AS") && tokens[j+2].is("(") {
+				ctes[strings.ToLower(tokens[j].text)] = true
+				j = closing[j+2] + 1
+				if j >= len(tokens) || !tokens[j].is(",") {
+					break
+				}
+				j++
+			}
+		case tok.is("FROM"):
+			if extract[depth] {
+				continue
+			}
+			// a IS [NOT] DISTINCT FROM b
+			if i >= 2 && tokens[i-1].is("DISTINCT") && (tokens[i-2].is("IS") || tokens[i-2].is("NOT")) {
+				continue
+			}
+			inFrom[depth] = true
+			if err := parseFromItem(i + 1); err != nil {
+				return nil, err
+			}
+		case tok.is("JOIN"):
+			inFrom[depth] = true
+			if err := parseFromItem(i + 1); err != nil {
+				return nil, err
+			}
+		case tok.is(",") && inFrom[depth]:
+			if err := parseFromItem(i + 1); err != nil {
+				return nil, err
+			}
+		case tok.kind == sqlIdentifier && fromClauseEnd[strings.ToUpper(tok.text)]:
+			delete(inFrom, depth)
+		}
+	}
+
+	var tables []*bq.Table
+	seen := make(map[string]bool)
+	for _, parts := range paths {
+		var table *bq.Table
+		switch len(parts) {
+		case 1:
+			if ctes[strings.ToLower(parts[0])] {
+				continue
+			}
+			return nil, fmt.Errorf("table %q is not qualified with a dataset", parts[0])
+		case 2:
+			if defaultProject == "" {
+				return nil, fmt.Errorf("table %q is not qualified with a project", strings.Join(parts, "."))
+			}
+			table = &bq.Table{ProjectID: defaultProject, DatasetID: parts[0], TableID: parts[1]}
+		case 3:
+			table = &bq.Table{ProjectID: parts[0], DatasetID: parts[1], TableID: parts[2]}
+		default:
+			return nil, fmt.Errorf("unsupported table reference %q", strings.Join(parts, "."))
+		}
+		if key := table.ProjectID + "." + table.DatasetID + "." + table.TableID; !seen[key] {
+			seen[key] = true
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
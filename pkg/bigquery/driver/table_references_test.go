@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"testing"
+
+	bq "cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tableReferencesFromSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []*bq.Table
+		wantErr string
+	}{
+		{
+			name:  "qualified and unqualified project",
+			query: "SELECT * FROM `other-project.sales.orders` o JOIN sales.customers AS c ON o.id = c.id",
+			want: []*bq.Table{
+				{ProjectID: "other-project", DatasetID: "sales", TableID: "orders"},
+				{ProjectID: "myproject", DatasetID: "sales", TableID: "customers"},
+			},
+		},
+		{
+			name:  "separately quoted parts, dashes and wildcard tables",
+			query: "SELECT * FROM `other-project`.`sales`.`orders`, my-project.logs.events_*",
+			want: []*bq.Table{
+				{ProjectID: "other-project", DatasetID: "sales", TableID: "orders"},
+				{ProjectID: "my-project", DatasetID: "logs", TableID: "events_*"},
+			},
+		},
+		{
+			name: "subqueries, CTEs and unions",
+			query: `WITH recent AS (SELECT * FROM sales.orders WHERE day > '2024-01-01'), top AS (SELECT * FROM recent)
+				SELECT * FROM top, (SELECT id FROM sales.returns) r
+				UNION ALL SELECT * FROM recent WHERE id IN (SELECT id FROM p.sales.flagged)`,
+			want: []*bq.Table{
+				{ProjectID: "myproject", DatasetID: "sales", TableID: "orders"},
+				{ProjectID: "myproject", DatasetID: "sales", TableID: "returns"},
+				{ProjectID: "p", DatasetID: "sales", TableID: "flagged"},
+			},
+		},
+		{
+			name: "FROM in expressions, strings and comments is ignored",
+			query: `SELECT EXTRACT(YEAR FROM day), a IS DISTINCT FROM b, 'FROM x.y', r"FROM x.y" -- FROM x.y
+				/* FROM x.y */ FROM sales.orders, UNNEST(items) AS item WITH OFFSET`,
+			want: []*bq.Table{
+				{ProjectID: "myproject", DatasetID: "sales", TableID: "orders"},
+			},
+		},
+		{
+			name:  "comma inside the select list is not a FROM item",
+			query: "SELECT a, b FROM sales.orders WHERE c IN (1, 2) ORDER BY a, b",
+			want: []*bq.Table{
+				{ProjectID: "myproject", DatasetID: "sales", TableID: "orders"},
+			},
+		},
+		{
+			name:  "parenthesized joins",
+			query: "SELECT * FROM (p.pii.contacts JOIN p.ok.t USING (id)), ((p.pii.accounts)), ((SELECT 1 FROM p.ok.u))",
+			want: []*bq.Table{
+				{ProjectID: "p", DatasetID: "pii", TableID: "contacts"},
+				{ProjectID: "p", DatasetID: "ok", TableID: "t"},
+				{ProjectID: "p", DatasetID: "pii", TableID: "accounts"},
+				{ProjectID: "p", DatasetID: "ok", TableID: "u"},
+			},
+		},
+		{
+			name:  "doubly parenthesized table",
+			query: "SELECT * FROM ((p.pii.contacts))",
+			want: []*bq.Table{
+				{ProjectID: "p", DatasetID: "pii", TableID: "contacts"},
+			},
+		},
+		{
+			name:    "table-valued functions are not supported",
+			query:   "SELECT * FROM ML.PREDICT(MODEL sales.model, TABLE sales.orders)",
+			wantErr: `table-valued function "ML.PREDICT"`,
+		},
+		{
+			name:    "unqualified tables are not supported",
+			query:   "SELECT * FROM orders",
+			wantErr: `table "orders" is not qualified with a dataset`,
+		},
+		{
+			name:    "unterminated strings are rejected",
+			query:   "SELECT 'abc FROM sales.orders",
+			wantErr: "unterminated string literal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tableReferencesFromSQL(tt.query, "myproject")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
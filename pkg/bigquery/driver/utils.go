@@ -2,9 +2,8 @@ package driver
 
 import (
 	"database/sql/driver"
-	b64 "encoding/base64"
+	"encoding/json"
 	"fmt"
-	"math/big"
 	"strings"
 	"time"
 
@@ -18,7 +17,7 @@ func ConvertColumnValue(v bigquery.Value, fieldSchema *bigquery.FieldSchema) (dr
 		return nil, nil
 	}
 
-	if fieldSchema.Type == "RECORD" {
+	if fieldSchema.Type == "RECORD" || fieldSchema.Type == "STRUCT" {
 		res, err := ConvertRecordValue(v.([]bigquery.Value), fieldSchema)
 		if err != nil {
 			return nil, err
@@ -35,63 +34,60 @@ func ConvertColumnValue(v bigquery.Value, fieldSchema *bigquery.FieldSchema) (dr
 		return res, nil
 	}
 
-	switch fieldSchema.Type {
-	case "TINYINT", "SMALLINT", "INT", "INTEGER", "INT64", "BIGINT":
-		// Ref https://github.com/googleapis/google-cloud-go/blob/1063c601a4c4a99217b45be0b25caa460e7157a1/datastore/load.go#L266
-		return v.(int64), nil
-	case "FLOAT", "FLOAT64":
-		return v.(float64), nil
-	case "STRING":
-		return v.(string), nil
-	case "BYTES":
-		return b64.StdEncoding.EncodeToString(v.([]byte)), nil
-	case "BOOLEAN":
-		return v.(bool), nil
-	case "TIME":
-		return bigquery.CivilTimeString(v.(civil.Time)), nil
-	case "DATE":
-		res := v.(civil.Date)
-		if !res.IsValid() {
-			return nil, nil
-		}
-		return res.String(), nil
-
-	case "DATETIME":
-		return bigquery.CivilDateTimeString(v.(civil.DateTime)), nil
-
-	case "NUMERIC", "BIGNUMERIC":
-		conv, _ := v.(*big.Rat).Float64()
-		return conv, nil
-	case "TIMESTAMP":
-		// TIMESTAMP values come as time.Time from BigQuery
-		return v.(time.Time), nil
-	case "JSON":
-		// JSON values are returned as strings from BigQuery
-		return v.(string), nil
-	case "INTERVAL":
-		// INTERVAL values are returned as *bigquery.IntervalValue from BigQuery
-		intervalValue := v.(*bigquery.IntervalValue)
-		return intervalValue.String(), nil
-	case "RANGE":
-		// RANGE values are returned as *bigquery.RangeValue from BigQuery
-		rangeValue := v.(*bigquery.RangeValue)
-		// Convert RangeValue to string representation like "[start,end)"
-		startStr := "unbounded"
-		endStr := "unbounded"
-		
-		if rangeValue.Start != nil {
-			startStr = fmt.Sprintf("%v", rangeValue.Start)
-		}
-		if rangeValue.End != nil {
-			endStr = fmt.Sprintf("%v", rangeValue.End)
-		}
-		
-		return fmt.Sprintf("[%s,%s)", startStr, endStr), nil
-	case "GEOGRAPHY":
-		return v.(string), nil
+	if columnType, ok := columnTypes[string(fieldSchema.Type)]; ok && columnType.convert != nil {
+		return columnType.convert(v)
+	}
+
+	// Unknown types are scanned as strings
+	return fmt.Sprintf("%v", v), nil
+}
+
+// IntervalSeconds converts an INTERVAL value to a number of seconds. Like
+// BigQuery's own interval arithmetic, a month counts as 30 days and a year
+// as 12 months.
+func IntervalSeconds(v *bigquery.IntervalValue) float64 {
+	days := (int64(v.Years)*12+int64(v.Months))*30 + int64(v.Days)
+	seconds := days*86400 + int64(v.Hours)*3600 + int64(v.Minutes)*60 + int64(v.Seconds)
+	return float64(seconds) + float64(v.SubSecondNanos)/1e9
+}
+
+// ConvertRangeBound converts the start or end of a RANGE value to a time.
+// DATE and DATETIME bounds are interpreted as UTC. Unbounded ends are nil.
+func ConvertRangeBound(v bigquery.Value) (bigquery.Value, error) {
+	switch bound := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		return bound, nil
+	case civil.Date:
+		return bound.In(time.UTC), nil
+	case civil.DateTime:
+		return bound.In(time.UTC), nil
 	default:
-		return v, nil
+		return nil, fmt.Errorf("unsupported RANGE element value %v of type %T", v, v)
+	}
+}
+
+// Converts a GEOGRAPHY value from its WKT representation to a GeoJSON geometry string
+func ConvertGeographyValue(v bigquery.Value) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	wkt, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported GEOGRAPHY value %v of type %T", v, v)
+	}
+	geometry, err := parseWKT(wkt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := json.Marshal(geometry)
+	if err != nil {
+		return nil, err
 	}
+	return string(res), nil
 }
 
 func ConvertArrayValue(v []bigquery.Value, fieldSchema *bigquery.FieldSchema) (string, error) {
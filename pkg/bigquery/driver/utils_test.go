@@ -105,6 +105,22 @@ func Test_ConvertColumnValue(t *testing.T) {
 			expectedType:  "string",
 			expectedValue: "1,2",
 		},
+		{
+			name:          "numeric type BIGINT",
+			value:         bigquery.Value(int64(1)),
+			columnType:    "BIGINT",
+			schema:        &bigquery.FieldSchema{Type: "BIGINT"},
+			expectedType:  "int64",
+			expectedValue: "1",
+		},
+		{
+			name:          "unknown type is converted to a string",
+			value:         bigquery.Value(int64(1)),
+			columnType:    "UNKNOWN",
+			schema:        &bigquery.FieldSchema{Type: "UNKNOWN"},
+			expectedType:  "string",
+			expectedValue: "1",
+		},
 		{
 			name:          "numeric type FLOAT",
 			value:         bigquery.Value(float64(1.99999)),
@@ -403,16 +419,32 @@ func Test_ConvertColumnValue(t *testing.T) {
 			value:         bigquery.Value(&bigquery.IntervalValue{SubSecondNanos: 1000}),
 			columnType:    "INTERVAL",
 			schema:        &bigquery.FieldSchema{Type: "INTERVAL"},
-			expectedType:  "string",
-			expectedValue: "0-0 0 0:0:0.000001",
+			expectedType:  "float64",
+			expectedValue: "1e-06",
+		},
+		{
+			name:          "INTERVAL with date parts",
+			value:         bigquery.Value(&bigquery.IntervalValue{Months: 1, Days: 2, Hours: 3, Minutes: 4, Seconds: 5, SubSecondNanos: 500000000}),
+			columnType:    "INTERVAL",
+			schema:        &bigquery.FieldSchema{Type: "INTERVAL"},
+			expectedType:  "float64",
+			expectedValue: "2.7758455e+06",
+		},
+		{
+			name:          "negative INTERVAL",
+			value:         bigquery.Value(&bigquery.IntervalValue{Hours: -1, Minutes: -30}),
+			columnType:    "INTERVAL",
+			schema:        &bigquery.FieldSchema{Type: "INTERVAL"},
+			expectedType:  "float64",
+			expectedValue: "-5400",
 		},
 		{
 			name:          "INTERVAL repeated",
-			value:         bigquery.Value([]bigquery.Value{&bigquery.IntervalValue{SubSecondNanos: 1000}, &bigquery.IntervalValue{Years: 1, SubSecondNanos: 2000}}),
+			value:         bigquery.Value([]bigquery.Value{&bigquery.IntervalValue{SubSecondNanos: 1000}, &bigquery.IntervalValue{Minutes: 1, SubSecondNanos: 2000}}),
 			columnType:    "INTERVAL",
 			schema:        &bigquery.FieldSchema{Type: "INTERVAL", Repeated: true},
 			expectedType:  "string",
-			expectedValue: "0-0 0 0:0:0.000001,1-0 0 0:0:0.000002",
+			expectedValue: "1e-06,60.000002",
 		},
 		{
 			name:          "RANGE",
@@ -0,0 +1,105 @@
+package bigquery
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-google-sdk-go/pkg/utils"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/pkg/errors"
+)
+
+// datasetLocationTTL is how long the location of a dataset is cached. A
+// dataset cannot be moved, but it can be deleted and recreated elsewhere.
+const datasetLocationTTL = time.Hour
+
+// datasetLocationFailureTTL is how long a failed dataset location lookup is
+// cached, so queries on a missing dataset do not each look it up again
+const datasetLocationFailureTTL = 30 * time.Second
+
+type datasetLocationEntry struct {
+	location string
+	err      error
+	expires  time.Time
+}
+
+// MutateQuery sets the location of a query without one to the location of the
+// dataset it targets. The location is stored in the connection arguments,
+// which sqlds connects once for, so queries on datasets in different
+// locations use different connections and a changed location takes effect
+// once its cache entry expires.
+func (s *BigQueryDatasource) MutateQuery(ctx context.Context, req backend.DataQuery) (context.Context, backend.DataQuery) {
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(req.JSON, &query); err != nil || query["connectionArgs"] == nil {
+		return ctx, req
+	}
+	var connectionArgs map[string]json.RawMessage
+	args, err := parseConnectionArgs(query["connectionArgs"])
+	if err != nil || args.Location != "" || args.Dataset == "" || json.Unmarshal(query["connectionArgs"], &connectionArgs) != nil {
+		return ctx, req
+	}
+	config := getDatasourceSettings(ctx)
+	if config == nil {
+		return ctx, req
+	}
+	settings, err := loadSettings(config)
+	if err != nil {
+		return ctx, req
+	}
+
+	loggerWithContext := s.logger.FromContext(ctx)
+	project := cmp.Or(args.Project, settings.DefaultProject)
+	if project == "" && settings.AuthenticationType == "gce" {
+		if project, err = utils.GCEDefaultProject(ctx, BigQueryScope); err != nil {
+			loggerWithContext.Warn("Failed to retrieve default GCE project", "error", err)
+			return ctx, req
+		}
+	}
+	location, err := s.datasetLocation(ctx, config, project, args.Dataset)
+	if err != nil {
+		loggerWithContext.Warn("Failed to resolve the dataset location, using the default location", "dataset", args.Dataset, "error", err)
+		return ctx, req
+	}
+
+	connectionArgs["location"], _ = json.Marshal(location)
+	query["connectionArgs"], _ = json.Marshal(connectionArgs)
+	req.JSON, _ = json.Marshal(query)
+	return ctx, req
+}
+
+// datasetLocation returns the location of the dataset a query targets, so
+// queries without a processing location run where their data is instead of
+// failing with "Dataset ... was not found in location". The dataset may be
+// qualified with its project. Locations are cached per data source and
+// dataset for datasetLocationTTL, and failed lookups for
+// datasetLocationFailureTTL.
+func (s *BigQueryDatasource) datasetLocation(ctx context.Context, config *backend.DataSourceInstanceSettings, project, dataset string) (string, error) {
+	if datasetProject, name, ok := strings.Cut(dataset, "."); ok {
+		project, dataset = datasetProject, name
+	}
+	key := fmt.Sprintf("%s/%s.%s", config.UID, project, dataset)
+	if entry, ok := s.datasetLocations.Load(key); ok && time.Now().Before(entry.(datasetLocationEntry).expires) {
+		return entry.(datasetLocationEntry).location, entry.(datasetLocationEntry).err
+	}
+
+	apiClient, err := s.newApi(ctx, config, project, "")
+	if err != nil {
+		return "", err
+	}
+	meta, err := apiClient.Client.Dataset(dataset).Metadata(ctx)
+	if err != nil {
+		err = errors.WithMessage(err, fmt.Sprintf("Failed to retrieve %s.%s dataset metadata", project, dataset))
+		// A cancelled request says nothing about the dataset
+		if ctx.Err() == nil {
+			s.datasetLocations.Store(key, datasetLocationEntry{err: err, expires: time.Now().Add(datasetLocationFailureTTL)})
+		}
+		return "", err
+	}
+
+	s.datasetLocations.Store(key, datasetLocationEntry{location: meta.Location, expires: time.Now().Add(datasetLocationTTL)})
+	return meta.Location, nil
+}
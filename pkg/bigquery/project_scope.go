@@ -0,0 +1,127 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+)
+
+var (
+	projectParentPattern     = regexp.MustCompile(`^(folders|organizations)/[0-9]+$`)
+	projectLabelKeyPattern   = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	projectLabelValuePattern = regexp.MustCompile(`^[a-z0-9_-]*$`)
+)
+
+// projectLabel is a project label entry of the accessible projects scope. An
+// empty value matches any value of the key.
+type projectLabel struct {
+	key   string
+	value string
+}
+
+// projectScope narrows the accessible projects to the projects under one of
+// the parents, folders or organizations, and carrying one of the labels.
+// An empty scope keeps every project.
+type projectScope struct {
+	parents map[string]bool
+	labels  []projectLabel
+}
+
+// parseProjectScope reads the accessible projects scope from the data source
+// settings. Parents are "folders/<id>" or "organizations/<id>", and labels
+// are "key" or "key:value".
+func parseProjectScope(settings types.BigQuerySettings) (projectScope, error) {
+	scope := projectScope{}
+	for _, entry := range parseList(settings.AccessibleProjectParents) {
+		if !projectParentPattern.MatchString(entry) {
+			return scope, fmt.Errorf("invalid project parent %q: use folders/<id> or organizations/<id>", entry)
+		}
+		if scope.parents == nil {
+			scope.parents = make(map[string]bool)
+		}
+		scope.parents[entry] = true
+	}
+	for _, entry := range parseList(settings.AccessibleProjectLabels) {
+		key, value, _ := strings.Cut(entry, ":")
+		if !projectLabelKeyPattern.MatchString(key) || !projectLabelValuePattern.MatchString(value) {
+			return scope, fmt.Errorf("invalid project label %q: use key or key:value", entry)
+		}
+		scope.labels = append(scope.labels, projectLabel{key: key, value: value})
+	}
+	return scope, nil
+}
+
+func (p projectScope) isEmpty() bool {
+	return len(p.parents) == 0 && len(p.labels) == 0
+}
+
+func (p projectScope) matchesLabels(project *cloudresourcemanager.Project) bool {
+	if len(p.labels) == 0 {
+		return true
+	}
+	for _, label := range p.labels {
+		if value, ok := project.Labels[label.key]; ok && (label.value == "" || label.value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the projects within the scope. Projects in nested folders
+// are matched by their ancestors, which are looked up with the resource
+// manager API; the lookup failing fails the whole listing rather than dropping
+// or keeping projects it could not place.
+func (p projectScope) filter(ctx context.Context, rmSvc *cloudresourcemanager.Service, projects []*cloudresourcemanager.Project) ([]*cloudresourcemanager.Project, error) {
+	if p.isEmpty() {
+		return projects, nil
+	}
+
+	// Parents of the folders looked up so far
+	folderParents := make(map[string]string)
+	scoped := make([]*cloudresourcemanager.Project, 0, len(projects))
+	for _, project := range projects {
+		if !p.matchesLabels(project) {
+			continue
+		}
+		if len(p.parents) > 0 {
+			inScope, err := p.underParent(ctx, rmSvc, project.Parent, folderParents)
+			if err != nil {
+				return nil, fmt.Errorf("could not resolve the parents of project %q: %w", project.ProjectId, err)
+			}
+			if !inScope {
+				continue
+			}
+		}
+		scoped = append(scoped, project)
+	}
+	return scoped, nil
+}
+
+// underParent reports whether parent, or one of its ancestors, is one of the
+// scope parents
+func (p projectScope) underParent(ctx context.Context, rmSvc *cloudresourcemanager.Service, parent string, folderParents map[string]string) (bool, error) {
+	for parent != "" {
+		if p.parents[parent] {
+			return true, nil
+		}
+		if !strings.HasPrefix(parent, "folders/") {
+			return false, nil
+		}
+		next, ok := folderParents[parent]
+		if !ok {
+			folder, err := rmSvc.Folders.Get(parent).Context(ctx).Do()
+			if err != nil {
+				return false, err
+			}
+			next = folder.Parent
+			folderParents[parent] = next
+		}
+		parent = next
+	}
+	return false, nil
+}
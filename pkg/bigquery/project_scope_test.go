@@ -0,0 +1,150 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/option"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+)
+
+// newHierarchyResourceManagerService returns a resource manager service
+// backed by a server listing projects and looking up folders. Folder lookups
+// are counted in folderLookups.
+func newHierarchyResourceManagerService(t *testing.T, projects []*cloudresourcemanager.Project, folderParents map[string]string, folderLookups *int) *cloudresourcemanager.Service {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response any
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/projects:search"):
+			response = cloudresourcemanager.SearchProjectsResponse{Projects: projects}
+		case strings.Contains(r.URL.Path, "/folders/"):
+			*folderLookups++
+			name := r.URL.Path[strings.Index(r.URL.Path, "folders/"):]
+			parent, ok := folderParents[name]
+			if !ok {
+				http.Error(w, `{"error":{"code":403,"message":"permission denied"}}`, http.StatusForbidden)
+				return
+			}
+			response = cloudresourcemanager.Folder{Name: name, Parent: parent}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+
+	rmSvc, err := cloudresourcemanager.NewService(t.Context(), option.WithEndpoint(server.URL), option.WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+	return rmSvc
+}
+
+func Test_parseProjectScope(t *testing.T) {
+	scope, err := parseProjectScope(types.BigQuerySettings{AccessibleProjectParents: "folders/123, organizations/456", AccessibleProjectLabels: "env:prod, grafana"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"folders/123": true, "organizations/456": true}, scope.parents)
+	assert.Equal(t, []projectLabel{{key: "env", value: "prod"}, {key: "grafana"}}, scope.labels)
+
+	scope, err = parseProjectScope(types.BigQuerySettings{})
+	require.NoError(t, err)
+	assert.True(t, scope.isEmpty())
+
+	_, err = parseProjectScope(types.BigQuerySettings{AccessibleProjectParents: "123"})
+	assert.ErrorContains(t, err, `invalid project parent "123"`)
+	_, err = parseProjectScope(types.BigQuerySettings{AccessibleProjectLabels: "Env:Prod"})
+	assert.ErrorContains(t, err, `invalid project label "Env:Prod"`)
+}
+
+func Test_projectScope_filter(t *testing.T) {
+	projects := []*cloudresourcemanager.Project{
+		{ProjectId: "analytics", Parent: "folders/10", Labels: map[string]string{"env": "prod"}},
+		{ProjectId: "reporting", Parent: "folders/11", Labels: map[string]string{"env": "prod"}},
+		{ProjectId: "sandbox", Parent: "folders/20", Labels: map[string]string{"env": "dev"}},
+		{ProjectId: "root", Parent: "organizations/1"},
+	}
+	// folders/11 is nested in folders/10; folders/20 is a sibling
+	folderParents := map[string]string{"folders/10": "organizations/1", "folders/11": "folders/10", "folders/20": "organizations/1"}
+	ids := func(projects []*cloudresourcemanager.Project) []string {
+		ids := make([]string, 0, len(projects))
+		for _, project := range projects {
+			ids = append(ids, project.ProjectId)
+		}
+		return ids
+	}
+
+	t.Run("folders include nested folders", func(t *testing.T) {
+		lookups := 0
+		rmSvc := newHierarchyResourceManagerService(t, projects, folderParents, &lookups)
+		scoped, err := projectScope{parents: map[string]bool{"folders/10": true}}.filter(t.Context(), rmSvc, projects)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"analytics", "reporting"}, ids(scoped))
+	})
+
+	t.Run("organizations include every folder", func(t *testing.T) {
+		lookups := 0
+		rmSvc := newHierarchyResourceManagerService(t, projects, folderParents, &lookups)
+		scoped, err := projectScope{parents: map[string]bool{"organizations/1": true}}.filter(t.Context(), rmSvc, projects)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"analytics", "reporting", "sandbox", "root"}, ids(scoped))
+		// Every folder is looked up once
+		assert.Equal(t, 3, lookups)
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		scoped, err := projectScope{labels: []projectLabel{{key: "env", value: "prod"}}}.filter(t.Context(), nil, projects)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"analytics", "reporting"}, ids(scoped))
+		scoped, err = projectScope{labels: []projectLabel{{key: "env"}}}.filter(t.Context(), nil, projects)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"analytics", "reporting", "sandbox"}, ids(scoped))
+	})
+
+	t.Run("unresolvable folders fail the listing", func(t *testing.T) {
+		lookups := 0
+		rmSvc := newHierarchyResourceManagerService(t, projects, map[string]string{"folders/10": "organizations/1"}, &lookups)
+		_, err := projectScope{parents: map[string]bool{"folders/99": true}}.filter(t.Context(), rmSvc, projects)
+		assert.ErrorContains(t, err, `could not resolve the parents of project "reporting"`)
+	})
+}
+
+func Test_Projects_projectScope(t *testing.T) {
+	origPluginConfigFromContext := PluginConfigFromContext
+	defer func() { PluginConfigFromContext = origPluginConfigFromContext }()
+	jsonData := `{"authenticationType":"jwt","restrictToAccessibleDatasets":true,"accessibleProjectLabels":"grafana"}`
+	PluginConfigFromContext = func(ctx context.Context) backend.PluginContext {
+		return backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{ID: 1, UID: "uid-1", JSONData: []byte(jsonData)}}
+	}
+
+	lookups := 0
+	ds := newBigQueryDatasource()
+	ds.resourceManagerServices["uid-1"] = newHierarchyResourceManagerService(t, []*cloudresourcemanager.Project{
+		{ProjectId: "dashboards", Labels: map[string]string{"grafana": "true"}},
+		{ProjectId: "sandbox"},
+	}, nil, &lookups)
+
+	projects, err := ds.Projects(t.Context(), ProjectsArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, []*Project{{ProjectId: "dashboards"}}, projects)
+
+	config := PluginConfigFromContext(t.Context()).DataSourceInstanceSettings
+	settings, err := loadSettings(config)
+	require.NoError(t, err)
+	accessible, err := ds.accessibleProjects(t.Context(), *config, settings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dashboards"}, accessible)
+
+	// Without the restriction, the project selector lists every project
+	jsonData = `{"authenticationType":"jwt","accessibleProjectLabels":"grafana"}`
+	projects, err = ds.Projects(t.Context(), ProjectsArgs{})
+	require.NoError(t, err)
+	assert.Len(t, projects, 2)
+}
@@ -60,6 +60,23 @@ func (r *ResourceHandler) datasets(rw http.ResponseWriter, req *http.Request) {
 	utils.SendResponse(res, nil, rw)
 }
 
+func (r *ResourceHandler) datasetDetails(rw http.ResponseWriter, req *http.Request) {
+	result := DatasetsArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing datasets request body", rw)
+		return
+	}
+
+	res, err := r.ds.DatasetDetails(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "fetching BigQuery dataset details", rw)
+		return
+	}
+
+	utils.SendResponse(res, nil, rw)
+}
+
 func (r *ResourceHandler) tableSchema(rw http.ResponseWriter, req *http.Request) {
 	result := TableSchemaArgs{}
 	err := utils.UnmarshalBody(req.Body, &result)
@@ -78,6 +95,92 @@ func (r *ResourceHandler) tableSchema(rw http.ResponseWriter, req *http.Request)
 	utils.SendResponse(res, nil, rw)
 }
 
+func (r *ResourceHandler) tableColumns(rw http.ResponseWriter, req *http.Request) {
+	result := TableColumnsArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing table columns request body", rw)
+		return
+	}
+
+	res, err := r.ds.TableColumns(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "fetching BigQuery table columns", rw)
+		return
+	}
+
+	utils.SendResponse(res, nil, rw)
+}
+
+func (r *ResourceHandler) routines(rw http.ResponseWriter, req *http.Request) {
+	result := RoutinesArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing routines request body", rw)
+		return
+	}
+
+	res, err := r.ds.Routines(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "fetching BigQuery routines", rw)
+		return
+	}
+
+	utils.SendResponse(res, nil, rw)
+}
+
+func (r *ResourceHandler) models(rw http.ResponseWriter, req *http.Request) {
+	result := ModelsArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing models request body", rw)
+		return
+	}
+
+	res, err := r.ds.Models(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "fetching BigQuery ML models", rw)
+		return
+	}
+
+	utils.SendResponse(res, nil, rw)
+}
+
+func (r *ResourceHandler) searchSchema(rw http.ResponseWriter, req *http.Request) {
+	result := SchemaSearchArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing schema search request body", rw)
+		return
+	}
+
+	res, err := r.ds.SearchSchema(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "searching BigQuery schema", rw)
+		return
+	}
+
+	utils.SendResponse(res, nil, rw)
+}
+
+func (r *ResourceHandler) tablePreview(rw http.ResponseWriter, req *http.Request) {
+	result := TablePreviewArgs{}
+	err := utils.UnmarshalBody(req.Body, &result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "parsing table preview request body", rw)
+		return
+	}
+
+	res, err := r.ds.TablePreview(req.Context(), result)
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "previewing BigQuery table", rw)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	utils.SendResponse(res, nil, rw)
+}
+
 func (r *ResourceHandler) validateQuery(rw http.ResponseWriter, req *http.Request) {
 	result := ValidateQueryArgs{}
 	err := utils.UnmarshalBody(req.Body, &result)
@@ -112,12 +215,37 @@ func (r *ResourceHandler) projects(rw http.ResponseWriter, req *http.Request) {
 	utils.SendResponse(res, err, rw)
 }
 
+func (r *ResourceHandler) refreshProjects(rw http.ResponseWriter, req *http.Request) {
+	// Refreshing lists the projects again, so it must not be triggered by a
+	// mere GET such as a prefetch
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		utils.WriteResponse(rw, []byte("method not allowed"))
+		return
+	}
+	res, err := r.ds.RefreshAccessibleProjects(req.Context())
+	if err != nil {
+		utils.SendErrorResponse(req.Context(), err, "refreshing accessible BigQuery projects", rw)
+		return
+	}
+
+	utils.SendResponse(res, err, rw)
+}
+
 func (r *ResourceHandler) Routes() map[string]func(http.ResponseWriter, *http.Request) {
 	return map[string]func(http.ResponseWriter, *http.Request){
-		"/defaultProjects":      r.defaultProjects,
-		"/datasets":             r.datasets,
-		"/dataset/table/schema": r.tableSchema,
-		"/validateQuery":        r.validateQuery,
-		"/projects":             r.projects,
+		"/defaultProjects":       r.defaultProjects,
+		"/datasets":              r.datasets,
+		"/datasets/details":      r.datasetDetails,
+		"/dataset/table/schema":  r.tableSchema,
+		"/dataset/table/preview": r.tablePreview,
+		"/dataset/table/columns": r.tableColumns,
+		"/dataset/routines":      r.routines,
+		"/models":                r.models,
+		"/search":                r.searchSchema,
+		"/validateQuery":         r.validateQuery,
+		"/projects":              r.projects,
+		"/projects/refresh":      r.refreshProjects,
 	}
 }
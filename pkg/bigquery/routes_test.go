@@ -0,0 +1,24 @@
+package bigquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshProjectsRequiresPost(t *testing.T) {
+	// No settings in the request context: a POST reaches the data source
+	// and fails there
+	handler := newResourceHandler(newBigQueryDatasource())
+
+	rw := httptest.NewRecorder()
+	handler.refreshProjects(rw, httptest.NewRequest(http.MethodGet, "/projects/refresh", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	assert.Equal(t, http.MethodPost, rw.Header().Get("Allow"))
+
+	rw = httptest.NewRecorder()
+	handler.refreshProjects(rw, httptest.NewRequest(http.MethodPost, "/projects/refresh", nil))
+	assert.NotEqual(t, http.StatusMethodNotAllowed, rw.Code)
+}
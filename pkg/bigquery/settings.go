@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/driver"
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 	"github.com/grafana/grafana-google-sdk-go/pkg/utils"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -33,6 +34,25 @@ func loadSettings(config *backend.DataSourceInstanceSettings) (types.BigQuerySet
 		return settings, err
 	}
 
+	for _, entry := range parseList(settings.AdditionalAllowedDatasets) {
+		if _, err := driver.ParseAllowedDataset(entry); err != nil {
+			return settings, err
+		}
+	}
+	for _, entry := range parseList(settings.DeniedTables) {
+		if _, err := driver.ParseDeniedTable(entry); err != nil {
+			return settings, err
+		}
+	}
+	if _, err := parseProjectScope(settings); err != nil {
+		return settings, err
+	}
+	for _, entry := range parseList(settings.AllowedStatementTypes) {
+		if _, err := driver.ParseStatementType(entry); err != nil {
+			return settings, err
+		}
+	}
+
 	settings.DatasourceId = config.ID
 	settings.Updated = config.Updated
 
@@ -46,8 +66,16 @@ func getConnectionSettings(settings types.BigQuerySettings, queryArgs *Connectio
 		AuthenticationType: settings.AuthenticationType,
 		MaxBytesBilled:     settings.MaxBytesBilled,
 
+		GeographyAsGeoJSON:   settings.GeographyAsGeoJSON,
+		ExtractJSONKeys:      settings.ExtractJSONKeys,
+		UnitsFromColumnNames: settings.UnitsFromColumnNames,
+
 		RestrictToAccessibleDatasets: settings.RestrictToAccessibleDatasets,
-		AdditionalAllowedDatasets:    parseAllowedDatasets(settings.AdditionalAllowedDatasets),
+		AdditionalAllowedDatasets:    parseList(settings.AdditionalAllowedDatasets),
+		DeniedTables:                 parseList(settings.DeniedTables),
+
+		ReadOnly:              settings.ReadOnly,
+		AllowedStatementTypes: parseList(settings.AllowedStatementTypes),
 	}
 
 	// We want to set the location to empty string only if query args are set
@@ -70,15 +98,17 @@ func getConnectionSettings(settings types.BigQuerySettings, queryArgs *Connectio
 	return connectionSettings
 }
 
-// parseAllowedDatasets splits the comma-separated allowlist from the data source
-// settings into trimmed, non-empty entries. Returns nil when the allowlist is
-// not configured.
-func parseAllowedDatasets(raw string) []string {
-	var allowed []string
+// parseList splits a comma-separated list from the data source settings, such
+// as the allowed datasets, denied tables, statement types or project parents
+// and labels, into trimmed, non-empty entries. Entries are validated by the
+// parser of each list, such as driver.ParseAllowedDataset. Returns nil when
+// the list is not configured.
+func parseList(raw string) []string {
+	var entries []string
 	for _, entry := range strings.Split(raw, ",") {
 		if entry = strings.TrimSpace(entry); entry != "" {
-			allowed = append(allowed, entry)
+			entries = append(entries, entry)
 		}
 	}
-	return allowed
+	return entries
 }
@@ -1,13 +1,16 @@
 package bigquery
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestParseAllowedDatasets(t *testing.T) {
+func TestParseList(t *testing.T) {
 	tests := []struct {
 		name string
 		raw  string
@@ -25,7 +28,7 @@ func TestParseAllowedDatasets(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, parseAllowedDatasets(tt.raw))
+			assert.Equal(t, tt.want, parseList(tt.raw))
 		})
 	}
 }
@@ -35,10 +38,60 @@ func TestGetConnectionSettingsDatasetRestriction(t *testing.T) {
 		DefaultProject:               "myproject",
 		RestrictToAccessibleDatasets: true,
 		AdditionalAllowedDatasets:    "sales, other-project.analytics",
+		DeniedTables:                 "myproject.sales.customers",
 	}
 
 	connectionSettings := getConnectionSettings(settings, &ConnectionArgs{}, false)
 
 	assert.True(t, connectionSettings.RestrictToAccessibleDatasets)
 	assert.Equal(t, []string{"sales", "other-project.analytics"}, connectionSettings.AdditionalAllowedDatasets)
+	assert.Equal(t, []string{"myproject.sales.customers"}, connectionSettings.DeniedTables)
+}
+
+func TestLoadSettingsValidatesAllowedDatasets(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "exact entries", raw: "sales, other-project.analytics"},
+		{name: "patterns", raw: "analytics-*.reporting_*, public-data.*, team-?.events_[0-9]"},
+		{name: "domain-scoped project", raw: "example.com:project.sales"},
+		{name: "empty dataset", raw: "other-project.", wantErr: `invalid dataset entry "other-project."`},
+		{name: "empty project", raw: ".sales", wantErr: `invalid dataset entry ".sales"`},
+		{name: "invalid characters", raw: "other project.sales", wantErr: `invalid dataset entry "other project.sales"`},
+		{name: "malformed pattern", raw: "other-project.sales_[", wantErr: `malformed pattern "sales_["`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, err := json.Marshal(map[string]any{"additionalAllowedDatasets": tt.raw})
+			require.NoError(t, err)
+			_, err = loadSettings(&backend.DataSourceInstanceSettings{JSONData: jsonData})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsValidatesDeniedTables(t *testing.T) {
+	_, err := loadSettings(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"deniedTables":"shared.crm.pii_*, myproject.sales.customers"}`)})
+	assert.NoError(t, err)
+
+	_, err = loadSettings(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"deniedTables":"shared.crm"}`)})
+	assert.ErrorContains(t, err, `invalid denied table "shared.crm"`)
+}
+
+func TestLoadSettingsValidatesAllowedStatementTypes(t *testing.T) {
+	settings, err := loadSettings(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"readOnly":true,"allowedStatementTypes":"SELECT, create_view"}`)})
+	require.NoError(t, err)
+	connectionSettings := getConnectionSettings(settings, &ConnectionArgs{}, false)
+	assert.True(t, connectionSettings.ReadOnly)
+	assert.Equal(t, []string{"SELECT", "create_view"}, connectionSettings.AllowedStatementTypes)
+
+	_, err = loadSettings(&backend.DataSourceInstanceSettings{JSONData: []byte(`{"allowedStatementTypes":"SELECT, SCRIPT"}`)})
+	assert.ErrorContains(t, err, `invalid statement type "SCRIPT"`)
 }
@@ -18,6 +18,16 @@ type BigQuerySettings struct {
 	MaxBytesBilled               int64  `json:"MaxBytesBilled,omitempty"`
 	RestrictToAccessibleDatasets bool   `json:"restrictToAccessibleDatasets,omitempty"`
 	AdditionalAllowedDatasets    string `json:"additionalAllowedDatasets,omitempty"`
+	DeniedTables                 string `json:"deniedTables,omitempty"`
+	AccessibleProjectsCacheTTL   int64  `json:"accessibleProjectsCacheTTL,omitempty"`
+	AccessibleProjectParents     string `json:"accessibleProjectParents,omitempty"`
+	AccessibleProjectLabels      string `json:"accessibleProjectLabels,omitempty"`
+	SchemaCacheTTL               int64  `json:"schemaCacheTTL,omitempty"`
+	ReadOnly                     bool   `json:"readOnly,omitempty"`
+	AllowedStatementTypes        string `json:"allowedStatementTypes,omitempty"`
+	GeographyAsGeoJSON           bool   `json:"geographyAsGeoJSON,omitempty"`
+	ExtractJSONKeys              bool   `json:"extractJsonKeys,omitempty"`
+	UnitsFromColumnNames         bool   `json:"unitsFromColumnNames,omitempty"`
 	Updated                      time.Time
 	AuthenticationType           string `json:"authenticationType"`
 	PrivateKeyPath               string `json:"privateKeyPath"`
@@ -42,14 +52,58 @@ type ConnectionSettings struct {
 	Headers            map[string][]string
 	MaxBytesBilled     int64
 	EnableStorageAPI   bool
+	// GeographyAsGeoJSON returns GEOGRAPHY columns as GeoJSON geometries, with
+	// additional latitude and longitude columns for columns holding points.
+	GeographyAsGeoJSON bool
+	// ExtractJSONKeys adds a column for every top-level key of JSON columns
+	ExtractJSONKeys bool
+	// UnitsFromColumnNames derives the unit of numeric columns from their name
+	// suffix, for example "_ms" or "_bytes"
+	UnitsFromColumnNames bool
 
 	RestrictToAccessibleDatasets bool
 	AdditionalAllowedDatasets    []string
+	// DeniedTables lists "project.dataset.table" patterns that queries may
+	// never reference, even when their project or dataset is allowed
+	DeniedTables []string
 	// AccessibleProjects returns the GCP projects the data source credentials
 	// can enumerate. Set by the datasource when RestrictToAccessibleDatasets
 	// is enabled.
 	AccessibleProjects func(ctx context.Context) ([]string, error)
+
+	// ReadOnly rejects queries whose statement type, as reported by a dry
+	// run, is not in AllowedStatementTypes
+	ReadOnly bool
+	// AllowedStatementTypes lists the statement types allowed in read-only
+	// mode, such as "SELECT". Defaults to SELECT only when empty.
+	AllowedStatementTypes []string
+
+	// AllowlistVerdicts caches the outcome of the read-only and dataset
+	// restriction checks so repeated queries skip the dry run. Set by the
+	// datasource when ReadOnly or RestrictToAccessibleDatasets is enabled.
+	AllowlistVerdicts VerdictCache
+}
+
+// VerdictCache caches the outcome of the query restriction checks by key,
+// derived from the query and the check: nil when the query is allowed,
+// otherwise the reason it is denied.
+type VerdictCache interface {
+	Get(key string) (verdict error, ok bool)
+	Set(key string, verdict error)
+}
+
+// DatasetInfo describes a dataset in dataset listings
+type DatasetInfo struct {
+	ID          string            `json:"id"`
+	Location    string            `json:"location"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// The default lifetime of new tables in the dataset, 0 when they do not
+	// expire.
+	DefaultTableExpiration time.Duration `json:"defaultTableExpiration,omitempty"`
+	CreationTime           time.Time     `json:"creationTime"`
 }
+
 type TableFieldSchema struct {
 	Name        string       `json:"name"`
 	Description string       `json:"description,omitempty"`
@@ -60,6 +114,84 @@ type TableFieldSchema struct {
 
 type TableSchema []*TableFieldSchema
 
+// ColumnMetadata describes a column of a table, or a field nested in a RECORD
+// column
+type ColumnMetadata struct {
+	// Name is the name of the field, Path its dotted path from the top-level
+	// column, such as "customer.address.city"
+	Name        string       `json:"name"`
+	Path        string       `json:"path"`
+	Type        bq.FieldType `json:"type"`
+	Repeated    bool         `json:"repeated"`
+	Required    bool         `json:"required"`
+	Description string       `json:"description,omitempty"`
+	PolicyTags  []string     `json:"policyTags,omitempty"`
+	// Pseudo is set for pseudo-columns such as _PARTITIONTIME, which are not
+	// part of the table schema
+	Pseudo bool `json:"pseudo,omitempty"`
+}
+
+// Routine describes a persistent user-defined function, table function or
+// stored procedure
+type Routine struct {
+	Name string `json:"name"`
+	// Type is SCALAR_FUNCTION, AGGREGATE_FUNCTION, TABLE_VALUED_FUNCTION or
+	// PROCEDURE
+	Type        string            `json:"type"`
+	Language    string            `json:"language,omitempty"`
+	Arguments   []RoutineArgument `json:"arguments"`
+	ReturnType  string            `json:"returnType,omitempty"`
+	Description string            `json:"description,omitempty"`
+	// Signature is the call signature, such as
+	// "parse_url(url STRING, part STRING) -> STRING"
+	Signature string `json:"signature"`
+}
+
+// RoutineArgument describes an argument of a routine
+type RoutineArgument struct {
+	Name string `json:"name"`
+	// Type is the SQL type of the argument, "ANY TYPE" for templated
+	// function arguments
+	Type string `json:"type"`
+	// Mode is IN, OUT or INOUT for procedure arguments
+	Mode string `json:"mode,omitempty"`
+}
+
+// Model describes a BigQuery ML model and the columns ML.PREDICT and similar
+// functions expect
+type Model struct {
+	Name string `json:"name"`
+	// Type is the model type, such as LINEAR_REGRESSION or ARIMA_PLUS
+	Type           string            `json:"type"`
+	Description    string            `json:"description,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	FeatureColumns []ModelColumn     `json:"featureColumns"`
+	LabelColumns   []ModelColumn     `json:"labelColumns"`
+	// TrainingTime is the start time of the latest training run, unset for
+	// imported models
+	TrainingTime     *time.Time `json:"trainingTime,omitempty"`
+	CreationTime     time.Time  `json:"creationTime"`
+	LastModifiedTime time.Time  `json:"lastModifiedTime"`
+	ExpirationTime   *time.Time `json:"expirationTime,omitempty"`
+}
+
+// ModelColumn is a feature or label column of a model
+type ModelColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SchemaSearchResult is a table whose name matches a schema search, or a
+// column of a table whose name matches it
+type SchemaSearchResult struct {
+	Dataset   string `json:"dataset"`
+	Table     string `json:"table"`
+	TableType string `json:"tableType"`
+	// Column and Type are empty when the table name matched
+	Column string `json:"column,omitempty"`
+	Type   string `json:"type,omitempty"`
+}
+
 type TimePartitioning struct {
 	// Defines the partition interval type.  Supported values are "DAY" or "HOUR".
 	Type bq.TimePartitioningType `json:"type,omitempty"`
@@ -95,4 +227,22 @@ type TableMetadataResponse struct {
 	TimePartitioning       TimePartitioning  `json:"timePartitioning,omitempty"`
 	RangePartitioning      RangePartitioning `json:"rangePartitioning,omitempty"`
 	RequirePartitionFilter bool              `json:"requirePartitionFilter,omitempty"`
+
+	// The type of table: TABLE, VIEW, MATERIALIZED_VIEW, EXTERNAL or SNAPSHOT.
+	Type        bq.TableType      `json:"type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// The fields the table is clustered by, in order.
+	ClusteringFields []string `json:"clusteringFields,omitempty"`
+	// The number of rows, the logical, uncompressed size and the physical,
+	// compressed size of the table, excluding the streaming buffer. Not set
+	// for views and external tables.
+	NumRows          uint64 `json:"numRows"`
+	NumBytes         int64  `json:"numBytes"`
+	NumPhysicalBytes int64  `json:"numPhysicalBytes"`
+	// When the table expires, if it does.
+	ExpirationTime   *time.Time `json:"expirationTime,omitempty"`
+	LastModifiedTime time.Time  `json:"lastModifiedTime"`
+	// The SQL defining a view or materialized view.
+	ViewQuery string `json:"viewQuery,omitempty"`
 }
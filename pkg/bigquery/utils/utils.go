@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	bq "cloud.google.com/go/bigquery"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"google.golang.org/api/googleapi"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 )
 
 func ColumnsFromTableSchema(schema bq.Schema, isOrderable bool) []string {
@@ -50,6 +54,311 @@ func isFieldOrderable(f *bq.FieldSchema) bool {
 	return f.Type != bq.GeographyFieldType && f.Type != bq.RecordFieldType
 }
 
+// PseudoColumns returns the pseudo-columns BigQuery provides for a table,
+// which are not part of its schema: _PARTITIONTIME on ingestion-time
+// partitioned tables, with _PARTITIONDATE when partitioned by day, and
+// _TABLE_SUFFIX on wildcard tables such as events_*
+func PseudoColumns(table string, timePartitioning *bq.TimePartitioning) bq.Schema {
+	schema := bq.Schema{}
+	if timePartitioning != nil && timePartitioning.Field == "" {
+		schema = append(schema, &bq.FieldSchema{
+			Name:        "_PARTITIONTIME",
+			Type:        bq.TimestampFieldType,
+			Description: "Ingestion time of the row, truncated to the partition boundary. Filter on it to limit the partitions scanned.",
+		})
+		if timePartitioning.Type == "" || timePartitioning.Type == bq.DayPartitioningType {
+			schema = append(schema, &bq.FieldSchema{
+				Name:        "_PARTITIONDATE",
+				Type:        bq.DateFieldType,
+				Description: "Ingestion date of the row. Filter on it to limit the partitions scanned.",
+			})
+		}
+	}
+	if strings.HasSuffix(table, "*") {
+		schema = append(schema, &bq.FieldSchema{
+			Name:        "_TABLE_SUFFIX",
+			Type:        bq.StringFieldType,
+			Description: "The part of the table name matched by the wildcard. Filter on it to limit the tables scanned.",
+		})
+	}
+	return schema
+}
+
+// sqlFieldTypes maps standard SQL type names to the field types of table
+// schemas
+var sqlFieldTypes = map[string]bq.FieldType{
+	"INT64":      bq.IntegerFieldType,
+	"FLOAT64":    bq.FloatFieldType,
+	"BOOL":       bq.BooleanFieldType,
+	"STRING":     bq.StringFieldType,
+	"BYTES":      bq.BytesFieldType,
+	"NUMERIC":    bq.NumericFieldType,
+	"BIGNUMERIC": bq.BigNumericFieldType,
+	"DATE":       bq.DateFieldType,
+	"DATETIME":   bq.DateTimeFieldType,
+	"TIME":       bq.TimeFieldType,
+	"TIMESTAMP":  bq.TimestampFieldType,
+	"GEOGRAPHY":  bq.GeographyFieldType,
+	"JSON":       bq.JSONFieldType,
+	"INTERVAL":   bq.IntervalFieldType,
+	"STRUCT":     bq.RecordFieldType,
+	"RANGE":      bq.RangeFieldType,
+}
+
+// FieldSchemaFromSQLType returns the schema of a field from its standard SQL
+// type, as INFORMATION_SCHEMA reports it, such as
+// ARRAY<STRUCT<name STRING, tags ARRAY<STRING>>> or NUMERIC(10, 2)
+func FieldSchemaFromSQLType(name, sqlType string) *bq.FieldSchema {
+	sqlType = strings.TrimSpace(sqlType)
+	if inner, ok := cutTypeParameters(sqlType, "ARRAY"); ok {
+		field := FieldSchemaFromSQLType(name, inner)
+		field.Repeated = true
+		return field
+	}
+
+	field := &bq.FieldSchema{Name: name}
+	if inner, ok := cutTypeParameters(sqlType, "STRUCT"); ok {
+		field.Type = bq.RecordFieldType
+		for _, member := range splitTopLevel(inner) {
+			memberName, memberType, _ := strings.Cut(strings.TrimSpace(member), " ")
+			field.Schema = append(field.Schema, FieldSchemaFromSQLType(strings.Trim(memberName, "`"), memberType))
+		}
+		return field
+	}
+	if inner, ok := cutTypeParameters(sqlType, "RANGE"); ok {
+		field.Type = bq.RangeFieldType
+		field.RangeElementType = &bq.RangeElementType{Type: sqlFieldTypes[strings.TrimSpace(inner)]}
+		return field
+	}
+
+	// Drop parameters, as in STRING(10), and anything following the type
+	base := strings.FieldsFunc(sqlType, func(r rune) bool { return r == '(' || r == ' ' })
+	if len(base) > 0 {
+		field.Type = sqlFieldTypes[strings.ToUpper(base[0])]
+	}
+	return field
+}
+
+// cutTypeParameters returns the type parameters of a parameterized type, such
+// as "INT64" for ARRAY<INT64>
+func cutTypeParameters(sqlType, kind string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(sqlType), kind+"<") || !strings.HasSuffix(sqlType, ">") {
+		return "", false
+	}
+	return sqlType[len(kind)+1 : len(sqlType)-1], true
+}
+
+// splitTopLevel splits the members of a STRUCT type on the commas that are
+// not nested in type parameters
+func splitTopLevel(members string) []string {
+	var res []string
+	depth, start := 0, 0
+	for i, r := range members {
+		switch r {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				res = append(res, members[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(members[start:]) != "" {
+		res = append(res, members[start:])
+	}
+	return res
+}
+
+// FieldByPath returns the field at a dotted path, such as
+// "customer.address.city", or nil when there is none
+func FieldByPath(schema bq.Schema, path string) *bq.FieldSchema {
+	name, rest, nested := strings.Cut(path, ".")
+	for _, field := range schema {
+		if field.Name != name {
+			continue
+		}
+		if !nested {
+			return field
+		}
+		return FieldByPath(field.Schema, rest)
+	}
+	return nil
+}
+
+// ColumnFilter narrows the columns returned by ColumnMetadataFromTableSchema.
+// Every enabled filter must match.
+type ColumnFilter struct {
+	// Orderable keeps columns that can be used in ORDER BY
+	Orderable bool `json:"orderable,omitempty"`
+	// Groupable keeps columns that can be used in GROUP BY
+	Groupable bool `json:"groupable,omitempty"`
+	// TimeLike keeps TIMESTAMP, DATE and DATETIME columns
+	TimeLike bool `json:"timeLike,omitempty"`
+}
+
+func (f ColumnFilter) isEmpty() bool {
+	return !f.Orderable && !f.Groupable && !f.TimeLike
+}
+
+// See https://cloud.google.com/bigquery/docs/reference/standard-sql/data-types#data_type_properties
+func (f ColumnFilter) matches(field *bq.FieldSchema) bool {
+	if f.isEmpty() {
+		return true
+	}
+	if field.Repeated {
+		return false
+	}
+	if f.Orderable && (field.Type == bq.GeographyFieldType || field.Type == bq.RecordFieldType || field.Type == bq.JSONFieldType) {
+		return false
+	}
+	if f.Groupable && (field.Type == bq.GeographyFieldType || field.Type == bq.JSONFieldType) {
+		return false
+	}
+	if f.TimeLike && field.Type != bq.TimestampFieldType && field.Type != bq.DateFieldType && field.Type != bq.DateTimeFieldType {
+		return false
+	}
+	return true
+}
+
+// ColumnMetadataFromTableSchema returns the columns of a table schema and the
+// fields nested in its RECORD columns that match filter. Fields nested in
+// repeated RECORD columns cannot be referenced by their path, so they are
+// only returned when no filter is enabled.
+func ColumnMetadataFromTableSchema(schema bq.Schema, filter ColumnFilter) []types.ColumnMetadata {
+	result := []types.ColumnMetadata{}
+	var walk func(schema bq.Schema, prefix string)
+	walk = func(schema bq.Schema, prefix string) {
+		for _, field := range schema {
+			path := prefix + field.Name
+			if filter.matches(field) {
+				column := types.ColumnMetadata{
+					Name:        field.Name,
+					Path:        path,
+					Type:        field.Type,
+					Repeated:    field.Repeated,
+					Required:    field.Required,
+					Description: field.Description,
+				}
+				if field.PolicyTags != nil {
+					column.PolicyTags = field.PolicyTags.Names
+				}
+				result = append(result, column)
+			}
+			if field.Schema != nil && (!field.Repeated || filter.isEmpty()) {
+				walk(field.Schema, path+".")
+			}
+		}
+	}
+	walk(schema, "")
+	return result
+}
+
+// RoutineFromMetadata describes a routine from its metadata
+func RoutineFromMetadata(name string, meta *bq.RoutineMetadata) types.Routine {
+	routine := types.Routine{
+		Name:        name,
+		Type:        meta.Type,
+		Language:    meta.Language,
+		Arguments:   []types.RoutineArgument{},
+		ReturnType:  StandardSQLTypeString(meta.ReturnType),
+		Description: meta.Description,
+	}
+	if meta.ReturnTableType != nil {
+		routine.ReturnType = "TABLE" + standardSQLFieldsString(meta.ReturnTableType.Columns)
+	}
+
+	args := make([]string, 0, len(meta.Arguments))
+	for _, arg := range meta.Arguments {
+		argType := StandardSQLTypeString(arg.DataType)
+		if arg.Kind == "ANY_TYPE" {
+			argType = "ANY TYPE"
+		}
+		mode := arg.Mode
+		if mode == "MODE_UNSPECIFIED" {
+			mode = ""
+		}
+		routine.Arguments = append(routine.Arguments, types.RoutineArgument{Name: arg.Name, Type: argType, Mode: mode})
+		args = append(args, strings.TrimSpace(strings.Join([]string{mode, arg.Name, argType}, " ")))
+	}
+	routine.Signature = fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+	if routine.ReturnType != "" {
+		routine.Signature += " -> " + routine.ReturnType
+	}
+	return routine
+}
+
+// ModelFromMetadata describes a model from its metadata
+func ModelFromMetadata(name string, meta *bq.ModelMetadata) (types.Model, error) {
+	featureColumns, err := meta.RawFeatureColumns()
+	if err != nil {
+		return types.Model{}, err
+	}
+	labelColumns, err := meta.RawLabelColumns()
+	if err != nil {
+		return types.Model{}, err
+	}
+
+	model := types.Model{
+		Name:             name,
+		Type:             meta.Type,
+		Description:      meta.Description,
+		Labels:           meta.Labels,
+		FeatureColumns:   modelColumns(featureColumns),
+		LabelColumns:     modelColumns(labelColumns),
+		CreationTime:     meta.CreationTime,
+		LastModifiedTime: meta.LastModifiedTime,
+	}
+	if !meta.ExpirationTime.IsZero() {
+		model.ExpirationTime = &meta.ExpirationTime
+	}
+	for _, run := range meta.RawTrainingRuns() {
+		startTime, err := time.Parse(time.RFC3339Nano, run.StartTime)
+		if err != nil {
+			continue
+		}
+		if model.TrainingTime == nil || startTime.After(*model.TrainingTime) {
+			model.TrainingTime = &startTime
+		}
+	}
+	return model, nil
+}
+
+func modelColumns(fields []*bq.StandardSQLField) []types.ModelColumn {
+	res := make([]types.ModelColumn, 0, len(fields))
+	for _, field := range fields {
+		res = append(res, types.ModelColumn{Name: field.Name, Type: StandardSQLTypeString(field.Type)})
+	}
+	return res
+}
+
+// StandardSQLTypeString formats a standard SQL type the way it is written in
+// queries, such as ARRAY<STRUCT<name STRING, value INT64>>. Types inferred
+// from a SQL function body are not set and format as an empty string.
+func StandardSQLTypeString(t *bq.StandardSQLDataType) string {
+	switch {
+	case t == nil:
+		return ""
+	case t.ArrayElementType != nil:
+		return "ARRAY<" + StandardSQLTypeString(t.ArrayElementType) + ">"
+	case t.RangeElementType != nil:
+		return "RANGE<" + StandardSQLTypeString(t.RangeElementType) + ">"
+	case t.StructType != nil:
+		return "STRUCT" + standardSQLFieldsString(t.StructType.Fields)
+	}
+	return t.TypeKind
+}
+
+func standardSQLFieldsString(fields []*bq.StandardSQLField) string {
+	res := make([]string, 0, len(fields))
+	for _, field := range fields {
+		res = append(res, strings.TrimSpace(field.Name+" "+StandardSQLTypeString(field.Type)))
+	}
+	return "<" + strings.Join(res, ", ") + ">"
+}
+
 func UnmarshalBody(body io.ReadCloser, reqBody any) error {
 	b, err := io.ReadAll(body)
 	if err != nil {
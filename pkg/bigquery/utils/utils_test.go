@@ -5,6 +5,9 @@ import (
 
 	bq "cloud.google.com/go/bigquery"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
 )
 
 func Test_ColumnsFromTableSchema(t *testing.T) {
@@ -47,3 +50,151 @@ func Test_ColumnsFromTableSchema(t *testing.T) {
 		assert.Equal(t, []string{"field1", "field2", "field2.field2_1", "field2.field2_2", "field2.field2_2.field2_2_1", "field3"}, result)
 	})
 }
+
+func Test_ColumnMetadataFromTableSchema(t *testing.T) {
+	schema := bq.Schema{
+		{Name: "created_at", Type: bq.TimestampFieldType, Required: true, Description: "Creation time"},
+		{Name: "day", Type: bq.DateFieldType},
+		{Name: "location", Type: bq.GeographyFieldType},
+		{Name: "payload", Type: bq.JSONFieldType},
+		{Name: "email", Type: bq.StringFieldType, PolicyTags: &bq.PolicyTagList{Names: []string{"projects/p/locations/us/taxonomies/1/policyTags/2"}}},
+		{Name: "customer", Type: bq.RecordFieldType, Schema: bq.Schema{
+			{Name: "name", Type: bq.StringFieldType},
+			{Name: "signed_up", Type: bq.DateTimeFieldType},
+		}},
+		{Name: "events", Type: bq.RecordFieldType, Repeated: true, Schema: bq.Schema{
+			{Name: "at", Type: bq.TimestampFieldType},
+		}},
+		{Name: "tags", Type: bq.StringFieldType, Repeated: true},
+	}
+	paths := func(columns []types.ColumnMetadata) []string {
+		result := make([]string, 0, len(columns))
+		for _, column := range columns {
+			result = append(result, column.Path)
+		}
+		return result
+	}
+
+	t.Run("all columns", func(t *testing.T) {
+		result := ColumnMetadataFromTableSchema(schema, ColumnFilter{})
+		assert.Equal(t, []string{"created_at", "day", "location", "payload", "email", "customer", "customer.name", "customer.signed_up", "events", "events.at", "tags"}, paths(result))
+		assert.Equal(t, types.ColumnMetadata{Name: "created_at", Path: "created_at", Type: bq.TimestampFieldType, Required: true, Description: "Creation time"}, result[0])
+		assert.Equal(t, []string{"projects/p/locations/us/taxonomies/1/policyTags/2"}, result[4].PolicyTags)
+		assert.Equal(t, types.ColumnMetadata{Name: "signed_up", Path: "customer.signed_up", Type: bq.DateTimeFieldType}, result[7])
+		assert.True(t, result[8].Repeated)
+	})
+
+	t.Run("orderable", func(t *testing.T) {
+		result := ColumnMetadataFromTableSchema(schema, ColumnFilter{Orderable: true})
+		assert.Equal(t, []string{"created_at", "day", "email", "customer.name", "customer.signed_up"}, paths(result))
+	})
+
+	t.Run("groupable", func(t *testing.T) {
+		result := ColumnMetadataFromTableSchema(schema, ColumnFilter{Groupable: true})
+		assert.Equal(t, []string{"created_at", "day", "email", "customer", "customer.name", "customer.signed_up"}, paths(result))
+	})
+
+	t.Run("time-like", func(t *testing.T) {
+		result := ColumnMetadataFromTableSchema(schema, ColumnFilter{TimeLike: true})
+		assert.Equal(t, []string{"created_at", "day", "customer.signed_up"}, paths(result))
+	})
+}
+
+func Test_PseudoColumns(t *testing.T) {
+	names := func(schema bq.Schema) []string {
+		result := make([]string, 0, len(schema))
+		for _, field := range schema {
+			result = append(result, field.Name)
+		}
+		return result
+	}
+
+	assert.Empty(t, PseudoColumns("orders", nil))
+	// Column-partitioned tables have no partition pseudo-columns
+	assert.Empty(t, PseudoColumns("orders", &bq.TimePartitioning{Type: bq.DayPartitioningType, Field: "created_at"}))
+	assert.Equal(t, []string{"_PARTITIONTIME", "_PARTITIONDATE"}, names(PseudoColumns("orders", &bq.TimePartitioning{Type: bq.DayPartitioningType})))
+	assert.Equal(t, []string{"_PARTITIONTIME"}, names(PseudoColumns("orders", &bq.TimePartitioning{Type: bq.HourPartitioningType})))
+	assert.Equal(t, []string{"_TABLE_SUFFIX"}, names(PseudoColumns("events_*", nil)))
+
+	// Pseudo-columns can be filtered like any column
+	pseudo := PseudoColumns("events_*", &bq.TimePartitioning{})
+	assert.Equal(t, []string{"_PARTITIONTIME", "_PARTITIONDATE"}, names(pseudo[:2]))
+	timeLike := ColumnMetadataFromTableSchema(pseudo, ColumnFilter{TimeLike: true})
+	assert.Len(t, timeLike, 2)
+	assert.Equal(t, bq.TimestampFieldType, timeLike[0].Type)
+}
+
+func Test_RoutineFromMetadata(t *testing.T) {
+	t.Run("scalar function", func(t *testing.T) {
+		routine := RoutineFromMetadata("parse_url", &bq.RoutineMetadata{
+			Type:        bq.ScalarFunctionRoutine,
+			Language:    "SQL",
+			Description: "Extracts a part of a URL",
+			Arguments: []*bq.RoutineArgument{
+				{Name: "url", Kind: "FIXED_TYPE", DataType: &bq.StandardSQLDataType{TypeKind: "STRING"}},
+				{Name: "parts", Kind: "FIXED_TYPE", DataType: &bq.StandardSQLDataType{ArrayElementType: &bq.StandardSQLDataType{TypeKind: "STRING"}}},
+				{Name: "default_value", Kind: "ANY_TYPE"},
+			},
+			ReturnType: &bq.StandardSQLDataType{StructType: &bq.StandardSQLStructType{Fields: []*bq.StandardSQLField{
+				{Name: "host", Type: &bq.StandardSQLDataType{TypeKind: "STRING"}},
+				{Name: "port", Type: &bq.StandardSQLDataType{TypeKind: "INT64"}},
+			}}},
+		})
+		assert.Equal(t, []types.RoutineArgument{
+			{Name: "url", Type: "STRING"},
+			{Name: "parts", Type: "ARRAY<STRING>"},
+			{Name: "default_value", Type: "ANY TYPE"},
+		}, routine.Arguments)
+		assert.Equal(t, "STRUCT<host STRING, port INT64>", routine.ReturnType)
+		assert.Equal(t, "parse_url(url STRING, parts ARRAY<STRING>, default_value ANY TYPE) -> STRUCT<host STRING, port INT64>", routine.Signature)
+		assert.Equal(t, "Extracts a part of a URL", routine.Description)
+	})
+
+	t.Run("table function", func(t *testing.T) {
+		routine := RoutineFromMetadata("orders_since", &bq.RoutineMetadata{
+			Type:      bq.TableValuedFunctionRoutine,
+			Arguments: []*bq.RoutineArgument{{Name: "since", Kind: "FIXED_TYPE", DataType: &bq.StandardSQLDataType{TypeKind: "DATE"}}},
+			ReturnTableType: &bq.StandardSQLTableType{Columns: []*bq.StandardSQLField{
+				{Name: "id", Type: &bq.StandardSQLDataType{TypeKind: "INT64"}},
+			}},
+		})
+		assert.Equal(t, "orders_since(since DATE) -> TABLE<id INT64>", routine.Signature)
+	})
+
+	t.Run("procedure without arguments and inferred return type", func(t *testing.T) {
+		routine := RoutineFromMetadata("refresh", &bq.RoutineMetadata{Type: bq.ProcedureRoutine})
+		assert.Equal(t, "refresh()", routine.Signature)
+		assert.Empty(t, routine.Arguments)
+		assert.NotNil(t, routine.Arguments)
+
+		routine = RoutineFromMetadata("merge_into", &bq.RoutineMetadata{
+			Type: bq.ProcedureRoutine,
+			Arguments: []*bq.RoutineArgument{
+				{Name: "target", Mode: "IN", DataType: &bq.StandardSQLDataType{TypeKind: "STRING"}},
+				{Name: "merged", Mode: "OUT", DataType: &bq.StandardSQLDataType{TypeKind: "INT64"}},
+			},
+		})
+		assert.Equal(t, "merge_into(IN target STRING, OUT merged INT64)", routine.Signature)
+	})
+}
+
+func Test_FieldSchemaFromSQLType(t *testing.T) {
+	assert.Equal(t, &bq.FieldSchema{Name: "id", Type: bq.IntegerFieldType}, FieldSchemaFromSQLType("id", "INT64"))
+	assert.Equal(t, &bq.FieldSchema{Name: "code", Type: bq.StringFieldType}, FieldSchemaFromSQLType("code", "STRING(10)"))
+	assert.Equal(t, &bq.FieldSchema{Name: "amount", Type: bq.NumericFieldType}, FieldSchemaFromSQLType("amount", "NUMERIC(10, 2)"))
+	assert.Equal(t, &bq.FieldSchema{Name: "tags", Type: bq.StringFieldType, Repeated: true}, FieldSchemaFromSQLType("tags", "ARRAY<STRING>"))
+	assert.Equal(t, &bq.FieldSchema{Name: "period", Type: bq.RangeFieldType, RangeElementType: &bq.RangeElementType{Type: bq.DateFieldType}}, FieldSchemaFromSQLType("period", "RANGE<DATE>"))
+
+	field := FieldSchemaFromSQLType("items", "ARRAY<STRUCT<sku STRING, price NUMERIC(10, 2), attributes STRUCT<color STRING, sizes ARRAY<INT64>>>>")
+	assert.Equal(t, bq.RecordFieldType, field.Type)
+	assert.True(t, field.Repeated)
+	require.Len(t, field.Schema, 3)
+	assert.Equal(t, "price", field.Schema[1].Name)
+	assert.Equal(t, bq.NumericFieldType, field.Schema[1].Type)
+	sizes := FieldByPath(bq.Schema{field}, "items.attributes.sizes")
+	require.NotNil(t, sizes)
+	assert.Equal(t, bq.IntegerFieldType, sizes.Type)
+	assert.True(t, sizes.Repeated)
+
+	assert.Nil(t, FieldByPath(bq.Schema{field}, "items.attributes.weight"))
+}
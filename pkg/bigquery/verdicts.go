@@ -0,0 +1,93 @@
+package bigquery
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/google-bigquery-datasource/pkg/bigquery/types"
+)
+
+// maxAllowlistVerdicts bounds the number of cached dataset restriction
+// verdicts of a data source
+const maxAllowlistVerdicts = 10000
+
+type allowlistVerdictEntry struct {
+	verdict error
+	// settingsUpdated and projectsFetchedAt identify the data source settings
+	// and accessible projects the verdict was reached with
+	settingsUpdated   time.Time
+	projectsFetchedAt time.Time
+	expires           time.Time
+}
+
+// allowlistVerdictCache caches the read-only and dataset restriction verdicts
+// of the queries run on one connection, keyed by data source, location,
+// project and verdict key. Verdicts are dropped when the data source settings
+// are updated or the accessible projects they were reached with expire.
+type allowlistVerdictCache struct {
+	ds     *BigQueryDatasource
+	config backend.DataSourceInstanceSettings
+	prefix string
+	// ttl is how long the accessible projects of the data source are cached
+	ttl time.Duration
+}
+
+var _ types.VerdictCache = (*allowlistVerdictCache)(nil)
+
+func (s *BigQueryDatasource) newAllowlistVerdictCache(config backend.DataSourceInstanceSettings, location string, project string, ttl time.Duration) *allowlistVerdictCache {
+	return &allowlistVerdictCache{ds: s, config: config, prefix: config.UID + "/" + location + ":" + project + "\n", ttl: ttl}
+}
+
+// projectsFetchedAt returns when the accessible projects in use were fetched,
+// or the zero time when none are cached, as with OAuth passthrough
+func (c *allowlistVerdictCache) projectsFetchedAt() time.Time {
+	if entry, ok := c.ds.accessibleProjectsCache.Load(c.config.UID); ok {
+		return entry.(accessibleProjectsEntry).fetchedAt
+	}
+	return time.Time{}
+}
+
+func (c *allowlistVerdictCache) Get(key string) (error, bool) {
+	c.ds.allowlistVerdictsMu.Lock()
+	defer c.ds.allowlistVerdictsMu.Unlock()
+
+	entry, ok := c.ds.allowlistVerdicts[c.prefix+key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.settingsUpdated.Equal(c.config.Updated) || !entry.projectsFetchedAt.Equal(c.projectsFetchedAt()) || time.Now().After(entry.expires) {
+		delete(c.ds.allowlistVerdicts, c.prefix+key)
+		return nil, false
+	}
+	return entry.verdict, true
+}
+
+func (c *allowlistVerdictCache) Set(key string, verdict error) {
+	projectsFetchedAt := c.projectsFetchedAt()
+	expires := time.Now().Add(c.ttl)
+	if !projectsFetchedAt.IsZero() {
+		expires = projectsFetchedAt.Add(c.ttl)
+	}
+
+	c.ds.allowlistVerdictsMu.Lock()
+	defer c.ds.allowlistVerdictsMu.Unlock()
+
+	if len(c.ds.allowlistVerdicts) >= maxAllowlistVerdicts {
+		now := time.Now()
+		for cached, entry := range c.ds.allowlistVerdicts {
+			if now.After(entry.expires) {
+				delete(c.ds.allowlistVerdicts, cached)
+			}
+		}
+		if len(c.ds.allowlistVerdicts) >= maxAllowlistVerdicts {
+			clear(c.ds.allowlistVerdicts)
+		}
+	}
+	c.ds.allowlistVerdicts[c.prefix+key] = allowlistVerdictEntry{
+		verdict:           verdict,
+		settingsUpdated:   c.config.Updated,
+		projectsFetchedAt: projectsFetchedAt,
+		expires:           expires,
+	}
+}
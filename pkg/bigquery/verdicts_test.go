@@ -0,0 +1,79 @@
+package bigquery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_allowlistVerdictCache(t *testing.T) {
+	config := backend.DataSourceInstanceSettings{UID: "uid-1", Updated: time.Now()}
+	denied := errors.New("denied")
+
+	newCache := func() (*BigQueryDatasource, *allowlistVerdictCache) {
+		ds := newBigQueryDatasource()
+		ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"myproject"}, fetchedAt: time.Now()})
+		return ds, ds.newAllowlistVerdictCache(config, "US", "myproject", accessibleProjectsCacheTTL)
+	}
+
+	t.Run("stores allowed and denied verdicts", func(t *testing.T) {
+		_, cache := newCache()
+		_, ok := cache.Get("SELECT 1")
+		assert.False(t, ok)
+
+		cache.Set("SELECT 1", nil)
+		cache.Set("SELECT 2", denied)
+
+		verdict, ok := cache.Get("SELECT 1")
+		assert.True(t, ok)
+		assert.NoError(t, verdict)
+		verdict, ok = cache.Get("SELECT 2")
+		assert.True(t, ok)
+		assert.Equal(t, denied, verdict)
+	})
+
+	t.Run("verdicts are scoped to the connection", func(t *testing.T) {
+		ds, cache := newCache()
+		cache.Set("SELECT 1", nil)
+		_, ok := ds.newAllowlistVerdictCache(config, "EU", "myproject", accessibleProjectsCacheTTL).Get("SELECT 1")
+		assert.False(t, ok)
+		_, ok = ds.newAllowlistVerdictCache(config, "US", "other-project", accessibleProjectsCacheTTL).Get("SELECT 1")
+		assert.False(t, ok)
+	})
+
+	t.Run("updated settings invalidate verdicts", func(t *testing.T) {
+		ds, cache := newCache()
+		cache.Set("SELECT 1", nil)
+		updated := config
+		updated.Updated = config.Updated.Add(time.Second)
+		_, ok := ds.newAllowlistVerdictCache(updated, "US", "myproject", accessibleProjectsCacheTTL).Get("SELECT 1")
+		assert.False(t, ok)
+	})
+
+	t.Run("refetched accessible projects invalidate verdicts", func(t *testing.T) {
+		ds, cache := newCache()
+		cache.Set("SELECT 1", nil)
+		ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"myproject"}, fetchedAt: time.Now().Add(time.Second)})
+		_, ok := cache.Get("SELECT 1")
+		assert.False(t, ok)
+	})
+
+	t.Run("verdicts expire with the accessible projects", func(t *testing.T) {
+		ds, cache := newCache()
+		ds.accessibleProjectsCache.Store("uid-1", accessibleProjectsEntry{projects: []string{"myproject"}, fetchedAt: time.Now().Add(-accessibleProjectsCacheTTL)})
+		cache.Set("SELECT 1", nil)
+		_, ok := cache.Get("SELECT 1")
+		assert.False(t, ok)
+	})
+
+	t.Run("the cache is bounded", func(t *testing.T) {
+		ds, cache := newCache()
+		for i := range maxAllowlistVerdicts + 1 {
+			cache.Set(string(rune(i)), nil)
+		}
+		assert.LessOrEqual(t, len(ds.allowlistVerdicts), maxAllowlistVerdicts)
+	})
+}
@@ -26,6 +26,17 @@ export interface TableSchema {
     field?: string;
   };
   rangePartitioning?: any;
+  requirePartitionFilter?: boolean;
+  type?: 'TABLE' | 'VIEW' | 'MATERIALIZED_VIEW' | 'EXTERNAL' | 'SNAPSHOT';
+  description?: string;
+  labels?: Record<string, string>;
+  clusteringFields?: string[];
+  numRows?: number;
+  numBytes?: number;
+  numPhysicalBytes?: number;
+  expirationTime?: string;
+  lastModifiedTime?: string;
+  viewQuery?: string;
 }
 
 export interface ValidationResults {
@@ -39,6 +50,58 @@ export interface ValidationResults {
   } | null;
 }
 
+export interface DatasetInfo {
+  id: string;
+  location: string;
+  description?: string;
+  labels?: Record<string, string>;
+  // Default lifetime of new tables in nanoseconds, absent when they do not expire
+  defaultTableExpiration?: number;
+  creationTime: string;
+}
+
+export interface RoutineArgument {
+  name: string;
+  type: string;
+  mode?: 'IN' | 'OUT' | 'INOUT';
+}
+
+export interface Routine {
+  name: string;
+  type: 'SCALAR_FUNCTION' | 'AGGREGATE_FUNCTION' | 'TABLE_VALUED_FUNCTION' | 'PROCEDURE';
+  language?: string;
+  arguments: RoutineArgument[];
+  returnType?: string;
+  description?: string;
+  signature: string;
+}
+
+export interface ModelColumn {
+  name: string;
+  type: string;
+}
+
+export interface Model {
+  name: string;
+  type: string;
+  description?: string;
+  labels?: Record<string, string>;
+  featureColumns: ModelColumn[];
+  labelColumns: ModelColumn[];
+  trainingTime?: string;
+  creationTime: string;
+  lastModifiedTime: string;
+  expirationTime?: string;
+}
+
+export interface SchemaSearchResult {
+  dataset: string;
+  table: string;
+  tableType: string;
+  column?: string;
+  type?: string;
+}
+
 interface GCPProject {
   displayName: string;
   projectId: string;
@@ -47,9 +110,13 @@ interface GCPProject {
 export interface BigQueryAPI {
   getDefaultProject: () => string;
   getDatasets: (location: string, project: string) => Promise<string[]>;
+  getDatasetDetails: (location: string, project: string, filter?: string) => Promise<DatasetInfo[]>;
   getTables: (query: BigQueryQueryNG) => Promise<string[]>;
   getTableSchema: (query: BigQueryQueryNG) => Promise<TableSchema>;
   getColumns: (query: BigQueryQueryNG, isOrderable?: boolean) => Promise<string[]>;
+  getRoutines: (query: BigQueryQueryNG) => Promise<Routine[]>;
+  getModels: (query: BigQueryQueryNG) => Promise<Model[]>;
+  searchSchema: (project: string, location: string, search: string) => Promise<SchemaSearchResult[]>;
   validateQuery: (query: BigQueryQueryNG, range?: TimeRange) => Promise<ValidationResults>;
   getProjects: () => Promise<GCPProject[]>;
   dispose: () => void;
@@ -84,6 +151,18 @@ class BigQueryAPIClient implements BigQueryAPI {
     });
   };
 
+  getDatasetDetails = async (location: string, project: string, filter = '') => {
+    return await this.fromCache('datasetDetails', this._getDatasetDetails)(location, project, filter);
+  };
+
+  private _getDatasetDetails = async (location: string, project: string, filter: string): Promise<DatasetInfo[]> => {
+    return await getBackendSrv().post(this.resourcesUrl + '/datasets/details', {
+      project,
+      location,
+      filter,
+    });
+  };
+
   private _getProjects = async (): Promise<GCPProject[]> => {
     return await getBackendSrv().post(this.resourcesUrl + '/projects', {
       datasourceUid: this.datasourceUid,
@@ -164,6 +243,38 @@ class BigQueryAPIClient implements BigQueryAPI {
     );
   };
 
+  getRoutines = async (query: BigQueryQueryNG): Promise<Routine[]> => {
+    return this.fromCache('routines', this._getRoutines)(query.project, query.location, query.dataset);
+  };
+
+  private _getRoutines = async (project: string, location: string, dataset: string): Promise<Routine[]> => {
+    return await getBackendSrv().post(this.resourcesUrl + '/dataset/routines', {
+      project,
+      location,
+      dataset,
+    });
+  };
+
+  getModels = async (query: BigQueryQueryNG): Promise<Model[]> => {
+    return this.fromCache('models', this._getModels)(query.project, query.location, query.dataset);
+  };
+
+  private _getModels = async (project: string, location: string, dataset: string): Promise<Model[]> => {
+    return await getBackendSrv().post(this.resourcesUrl + '/models', {
+      project,
+      location,
+      dataset,
+    });
+  };
+
+  searchSchema = async (project: string, location: string, search: string): Promise<SchemaSearchResult[]> => {
+    return await getBackendSrv().post(this.resourcesUrl + '/search', {
+      project,
+      location,
+      query: search,
+    });
+  };
+
   private _getColumns = async (
     project: string,
     location: string,
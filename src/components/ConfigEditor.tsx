@@ -32,6 +32,16 @@ export const BigQueryConfigEditor: React.FC<BigQueryConfigEditorProps> = (props)
     });
   };
 
+  const onSchemaCacheTTLChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        schemaCacheTTL: Number(event.target.value),
+      },
+    });
+  };
+
   const onRestrictToAccessibleDatasetsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({
       ...options,
@@ -42,6 +52,56 @@ export const BigQueryConfigEditor: React.FC<BigQueryConfigEditorProps> = (props)
     });
   };
 
+  const onAccessibleProjectsCacheTTLChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        accessibleProjectsCacheTTL: Number(event.target.value),
+      },
+    });
+  };
+
+  const onReadOnlyChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        readOnly: event.target.checked,
+      },
+    });
+  };
+
+  const onGeographyAsGeoJSONChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        geographyAsGeoJSON: event.target.checked,
+      },
+    });
+  };
+
+  const onExtractJsonKeysChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        extractJsonKeys: event.target.checked,
+      },
+    });
+  };
+
+  const onUnitsFromColumnNamesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...jsonData,
+        unitsFromColumnNames: event.target.checked,
+      },
+    });
+  };
+
   const showServiceAccountImpersonation =
     jsonData.authenticationType === GoogleAuthType.JWT || jsonData.authenticationType === GoogleAuthType.GCE;
 
@@ -141,6 +201,18 @@ export const BigQueryConfigEditor: React.FC<BigQueryConfigEditorProps> = (props)
             onChange={onMaxBytesBilledChange}
           />
         </Field>
+        <Field
+          label="Schema cache TTL"
+          description="How long, in seconds, the table names and columns shown in the query editor are cached before they are loaded again. Defaults to 60."
+        >
+          <Input
+            className="width-30"
+            placeholder="Optional, example 300"
+            type={'number'}
+            value={jsonData.schemaCacheTTL || ''}
+            onChange={onSchemaCacheTTLChange}
+          />
+        </Field>
         <Field
           label="Restrict to accessible datasets"
           description={
@@ -160,8 +232,10 @@ export const BigQueryConfigEditor: React.FC<BigQueryConfigEditorProps> = (props)
             description={
               <span>
                 Comma-separated list of datasets outside the accessible projects that queries may also reference,
-                entered as <code>project.dataset</code> or <code>dataset</code> (in the default project). Use this for
-                public or shared datasets you want to allow.
+                entered as <code>project.dataset</code> or <code>dataset</code> (in the default project). Both parts
+                accept wildcards, for example <code>analytics-*.reporting_*</code> or <code>public-data.*</code>. Use this
+                for public or shared datasets you want to allow. Add a table name, as in
+                <code>project.dataset.table</code>, to allow only that table.
               </span>
             }
           >
@@ -174,6 +248,118 @@ export const BigQueryConfigEditor: React.FC<BigQueryConfigEditorProps> = (props)
             />
           </Field>
         )}
+        {jsonData.restrictToAccessibleDatasets && (
+          <Field
+            label="Denied tables"
+            description={
+              <span>
+                Comma-separated list of tables that queries may never reference, entered as{' '}
+                <code>project.dataset.table</code>. Wildcards are accepted, for example <code>shared.crm.pii_*</code>.
+                Denied tables take precedence over accessible projects and additional allowed datasets.
+              </span>
+            }
+          >
+            <Input
+              className="width-30"
+              placeholder="Optional, example: shared.crm.contacts"
+              type={'string'}
+              value={jsonData.deniedTables || ''}
+              onChange={onUpdateDatasourceJsonDataOption(props, 'deniedTables')}
+            />
+          </Field>
+        )}
+        {jsonData.restrictToAccessibleDatasets && jsonData.authenticationType !== GoogleAuthType.ForwardOAuthIdentity && (
+          <Field
+            label="Accessible project folders"
+            description={
+              <span>
+                Comma-separated list of folders and organizations, entered as <code>folders/ID</code> or{' '}
+                <code>organizations/ID</code>. Only projects under one of them, including in nested folders, count as
+                accessible.
+              </span>
+            }
+          >
+            <Input
+              className="width-30"
+              placeholder="Optional, example: folders/123456789"
+              type={'string'}
+              value={jsonData.accessibleProjectParents || ''}
+              onChange={onUpdateDatasourceJsonDataOption(props, 'accessibleProjectParents')}
+            />
+          </Field>
+        )}
+        {jsonData.restrictToAccessibleDatasets && jsonData.authenticationType !== GoogleAuthType.ForwardOAuthIdentity && (
+          <Field
+            label="Accessible project labels"
+            description={
+              <span>
+                Comma-separated list of project labels, entered as <code>key</code> or <code>key:value</code>. Only
+                projects carrying one of them count as accessible.
+              </span>
+            }
+          >
+            <Input
+              className="width-30"
+              placeholder="Optional, example: env:prod"
+              type={'string'}
+              value={jsonData.accessibleProjectLabels || ''}
+              onChange={onUpdateDatasourceJsonDataOption(props, 'accessibleProjectLabels')}
+            />
+          </Field>
+        )}
+        {jsonData.restrictToAccessibleDatasets && jsonData.authenticationType !== GoogleAuthType.ForwardOAuthIdentity && (
+          <Field
+            label="Accessible projects cache TTL"
+            description="How long, in seconds, the list of accessible projects is cached before it is fetched again. Defaults to 300."
+          >
+            <Input
+              className="width-30"
+              placeholder="Optional, example 60"
+              type={'number'}
+              value={jsonData.accessibleProjectsCacheTTL || ''}
+              onChange={onAccessibleProjectsCacheTTLChange}
+            />
+          </Field>
+        )}
+        <Field
+          label="Read-only"
+          description="Reject queries that would modify data, such as DELETE, DROP TABLE or CREATE OR REPLACE. Every query is checked with a dry run before it executes. Scripts, EXECUTE IMMEDIATE and procedure calls are always rejected."
+        >
+          <Switch value={jsonData.readOnly || false} onChange={onReadOnlyChange} />
+        </Field>
+        {jsonData.readOnly && (
+          <Field
+            label="Allowed statement types"
+            description="Comma-separated list of the BigQuery statement types read-only mode allows. Defaults to SELECT."
+          >
+            <Input
+              className="width-30"
+              placeholder="Optional, example: SELECT, CREATE_VIEW"
+              type={'string'}
+              value={jsonData.allowedStatementTypes || ''}
+              onChange={onUpdateDatasourceJsonDataOption(props, 'allowedStatementTypes')}
+            />
+          </Field>
+        )}
+
+        <Field
+          label="Return geography as GeoJSON"
+          description="Convert GEOGRAPHY columns from WKT to GeoJSON geometries. Columns that only hold points also get latitude and longitude fields, so they can be plotted on the Geomap panel without ST_X and ST_Y."
+        >
+          <Switch value={jsonData.geographyAsGeoJSON || false} onChange={onGeographyAsGeoJSONChange} />
+        </Field>
+        <Field
+          label="Extract JSON keys"
+          description="Add a field for every top-level key of JSON columns, named after the column and the key, for example payload.status."
+        >
+          <Switch value={jsonData.extractJsonKeys || false} onChange={onExtractJsonKeysChange} />
+        </Field>
+        <Field
+          label="Units from column names"
+          description="Set the unit of numeric fields from the column name suffix, for example _ms, _bytes or _pct. Units declared in column descriptions with [unit: ...] always take precedence."
+        >
+          <Switch value={jsonData.unitsFromColumnNames || false} onChange={onUnitsFromColumnNamesChange} />
+        </Field>
 
         {config.secureSocksDSProxyEnabled && (
           <SecureSocksProxySettings options={options} onOptionsChange={onOptionsChange} />
@@ -79,6 +79,10 @@ const mockApiClient = {
   getColumns: jest.fn().mockResolvedValue([]),
   getTables: jest.fn().mockResolvedValue([]),
   getDatasets: jest.fn().mockResolvedValue([]),
+  getDatasetDetails: jest.fn().mockResolvedValue([]),
+  getRoutines: jest.fn().mockResolvedValue([]),
+  getModels: jest.fn().mockResolvedValue([]),
+  searchSchema: jest.fn().mockResolvedValue([]),
   getProjects: jest.fn().mockResolvedValue([]),
   getTableSchema: jest.fn().mockResolvedValue(null),
   validateQuery: jest.fn().mockResolvedValue({ isValid: true }),
@@ -116,6 +116,7 @@ export class BigQueryDatasource extends DataSourceWithBackend<BigQueryQueryNG, B
       rawSql: interpolatedSql,
       format: queryModel.format,
       connectionArgs: {
+        project: queryModel.project,
         dataset: queryModel.dataset!,
         table: queryModel.table!,
         location: queryModel.location!,
@@ -39,6 +39,16 @@ export interface BigQueryOptions extends DataSourceOptions {
   MaxBytesBilled?: number;
   restrictToAccessibleDatasets?: boolean;
   additionalAllowedDatasets?: string;
+  deniedTables?: string;
+  accessibleProjectsCacheTTL?: number;
+  schemaCacheTTL?: number;
+  accessibleProjectParents?: string;
+  accessibleProjectLabels?: string;
+  readOnly?: boolean;
+  allowedStatementTypes?: string;
+  geographyAsGeoJSON?: boolean;
+  extractJsonKeys?: boolean;
+  unitsFromColumnNames?: boolean;
   serviceEndpoint?: string;
   oauthPassThru?: boolean;
 }
@@ -65,6 +75,7 @@ export interface QueryModel extends DataQuery {
   rawSql: string;
   format: QueryFormat;
   connectionArgs: {
+    project?: string;
     dataset: string;
     table: string;
     location: string;